@@ -3,28 +3,41 @@ package backup
 import (
 	"context"
 	"errors"
+	"os"
 	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/scribblerockerz/parachute/pkg/archive"
 	"github.com/scribblerockerz/parachute/pkg/config"
-	"github.com/scribblerockerz/parachute/pkg/s3"
+	"github.com/scribblerockerz/parachute/pkg/job"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var BackupCmd = &cobra.Command{
-	Use:    "backup LOCAL [flags]",
+	Use:    "backup [LOCAL...] [flags]",
 	Short:  "Create an archive (encrypted) of the LOCAL souce and move it to the REMOTE destination",
 	RunE:   runBackup,
 	PreRun: preRun,
 }
 
 func init() {
-	BackupCmd.Flags().StringP("remote", "r", "", "remote destination (S3)")
+	BackupCmd.Flags().StringArrayP("remote", "r", nil, "remote destination (S3), repeat to upload to multiple destinations")
+	BackupCmd.Flags().String("replication", "", "policy for multiple remotes (require_all, require_any)")
+	BackupCmd.Flags().Bool("parallel-uploads", false, "upload to multiple remotes in parallel")
 	BackupCmd.Flags().String("endpoint", "", "S3 endpoint")
 	BackupCmd.Flags().String("access-key", "", "S3 access key")
 	BackupCmd.Flags().String("secret-key", "", "S3 secret key")
+	BackupCmd.Flags().Bool("verify", false, "verify size and checksum of the uploaded object")
+	BackupCmd.Flags().Bool("verify-download", false, "verify the uploaded object by downloading it again")
+	BackupCmd.Flags().String("checksum", "", "additional checksum validated by the storage on upload (sha256, crc32c)")
+	BackupCmd.Flags().String("stdin-name", "", "archive stdin as a single file with this name")
+	BackupCmd.Flags().String("files-from", "", "read sources from a file (\"-\" for stdin), one path per line")
+	BackupCmd.Flags().String("files-from0", "", "read sources from a file (\"-\" for stdin), separated by NUL characters")
+	BackupCmd.Flags().String("base-dir", "", "directory to resolve relative paths of the file list against")
+	BackupCmd.Flags().StringArray("source", nil, "source stored under an alias inside of the archive (path:alias)")
+	BackupCmd.Flags().Bool("preserve-paths", false, "store sources under their absolute path instead of their base name")
+	BackupCmd.Flags().StringArray("tag", nil, "tag stored with the backup, to select it on restore")
 }
 
 // preRun will initialize viper flag bindings, to prevent overrides of the same key
@@ -33,107 +46,99 @@ func preRun(cmd *cobra.Command, args []string) {
 	viper.BindPFlag("access_key", cmd.Flags().Lookup("access-key"))
 	viper.BindPFlag("secret_key", cmd.Flags().Lookup("secret-key"))
 	viper.BindPFlag("remote", cmd.Flags().Lookup("remote"))
+	viper.BindPFlag("replication", cmd.Flags().Lookup("replication"))
+	viper.BindPFlag("parallel_uploads", cmd.Flags().Lookup("parallel-uploads"))
+	viper.BindPFlag("verify", cmd.Flags().Lookup("verify"))
+	viper.BindPFlag("verify_download", cmd.Flags().Lookup("verify-download"))
+	viper.BindPFlag("checksum_algorithm", cmd.Flags().Lookup("checksum"))
+	viper.BindPFlag("stdin_name", cmd.Flags().Lookup("stdin-name"))
+	viper.BindPFlag("files_from", cmd.Flags().Lookup("files-from"))
+	viper.BindPFlag("files_from0", cmd.Flags().Lookup("files-from0"))
+	viper.BindPFlag("base_dir", cmd.Flags().Lookup("base-dir"))
+	viper.BindPFlag("source", cmd.Flags().Lookup("source"))
+	viper.BindPFlag("preserve_paths", cmd.Flags().Lookup("preserve-paths"))
+	viper.BindPFlag("tag", cmd.Flags().Lookup("tag"))
 }
 
 func runBackup(cmd *cobra.Command, args []string) error {
 
 	log.Info().Strs("args", args).Msg("started backup creation")
 
-	err := validateBackupInput(args, viper.GetString("remote"))
+	err := validateBackupInput(args)
 	if err != nil {
 		return err
 	}
 
-	backupArgs, err := getBackupArgs(args, viper.GetString("remote"))
+	backupJob, err := getBackupJob(args)
 	if err != nil {
 		return err
 	}
 
-	err = config.ValidateS3Configuration()
+	result, err := backupJob.Run(context.Background())
 	if err != nil {
 		return err
 	}
 
-	a, err := archive.CreateArchiveFromSources(
-		backupArgs.source,
-		!viper.GetBool("no_encryption"),
-		viper.GetString("passphrase"),
-	)
-	if err != nil {
-		return err
-	}
+	log.Info().Str("destination", result.Remote).Msg("finsihed backup to destination")
 
-	client, err := s3.NewClient(
-		viper.GetString("endpoint"),
-		viper.GetString("access_key"),
-		viper.GetString("secret_key"),
-		true,
-	)
+	return nil
+}
 
-	if err != nil {
-		return err
-	}
+func validateBackupInput(args []string) error {
+	usesFileList := viper.GetString("files_from") != "" || viper.GetString("files_from0") != ""
 
-	payload, err := s3.NewPayload(backupArgs.destination, a.TempDestination())
-	if err != nil {
-		return err
+	if len(args) == 0 && viper.GetString("stdin_name") == "" && !usesFileList && len(viper.GetStringSlice("source")) == 0 {
+		return errors.New("source archive must be provided")
 	}
 
-	log.Debug().Str("bucket", payload.Bucket).Str("object", payload.Object).Msg("started uploading")
-
-	_, err = client.UploadPayload(
-		context.Background(),
-		payload,
-	)
-
-	if err != nil {
-		return err
+	if viper.GetString("stdin_name") != "" && config.ReadsFileListFromStdin() {
+		return errors.New("stdin can only be read once")
 	}
 
-	log.Debug().Str("bucket", payload.Bucket).Str("object", payload.Object).Msg("finished uploading")
-
-	err = a.Cleanup()
-	if err != nil {
-		return err
+	if strings.Contains(viper.GetString("stdin_name"), "/") {
+		return errors.New("stdin name must be a plain file name")
 	}
 
-	log.Info().Str("destination", backupArgs.destination).Msg("finsihed backup to destination")
+	if viper.GetBool("no_encryption") {
+		log.Warn().Msg("no encryption requested")
+	}
 
 	return nil
 }
 
-func validateBackupInput(args []string, remote string) error {
-	if len(args) == 0 {
-		return errors.New("source archive must be provided")
-	}
-
-	if !viper.GetBool("no_encryption") && viper.GetString("passphrase") == "" {
-		return errors.New("provided passphrase is empty")
-	}
+// getBackupJob describes the backup of the command line as an ad-hoc job
+func getBackupJob(args []string) (*job.Job, error) {
+	noEncryption := viper.GetBool("no_encryption")
+	verify := viper.GetBool("verify")
+	verifyDownload := viper.GetBool("verify_download")
 
-	if viper.GetBool("no_encryption") {
-		log.Warn().Msg("no encryption requested")
+	fileListSources, err := config.FileListSources()
+	if err != nil {
+		return nil, err
 	}
 
-	if remote == "" {
-		return errors.New("remote destination must be provided")
-	}
+	extraSources := fileListSources
 
-	if !strings.HasPrefix(remote, "s3://") {
-		return errors.New("remote must be declared in \"s3://bucket/some-path\" format")
+	if stdinName := viper.GetString("stdin_name"); stdinName != "" {
+		extraSources = append(extraSources, archive.Source{Name: stdinName, Reader: os.Stdin})
 	}
 
-	return nil
-}
-
-type backupArgs struct {
-	source      []string
-	destination string
-}
-
-func getBackupArgs(args []string, output string) (*backupArgs, error) {
-	return &backupArgs{
-		source:      args,
-		destination: output,
+	return &job.Job{
+		Sources:           args,
+		Aliases:           viper.GetStringSlice("source"),
+		PreservePaths:     viper.GetBool("preserve_paths"),
+		Tags:              viper.GetStringSlice("tag"),
+		ExtraSources:      extraSources,
+		Remotes:           viper.GetStringSlice("remote"),
+		Replication:       viper.GetString("replication"),
+		ParallelUploads:   viper.GetBool("parallel_uploads"),
+		NoEncryption:      &noEncryption,
+		Passphrase:        viper.GetString("passphrase"),
+		Key:               viper.GetString("key"),
+		Identity:          viper.GetString("identity"),
+		Format:            job.FORMAT_ZIP,
+		Verify:            &verify,
+		VerifyDownload:    &verifyDownload,
+		ChecksumAlgorithm: viper.GetString("checksum_algorithm"),
 	}, nil
 }
@@ -0,0 +1,157 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/s3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var CopyCmd = &cobra.Command{
+	Use:    "copy SOURCE DESTINATION [flags]",
+	Short:  "Stream backups between two remotes (S3), a SOURCE ending in \"/\" copies every object below the prefix",
+	RunE:   runCopy,
+	PreRun: preRun,
+}
+
+func init() {
+	CopyCmd.Flags().Bool("dry-run", false, "only print the objects which would be copied")
+}
+
+// preRun will initialize viper flag bindings, to prevent overrides of the same key
+func preRun(cmd *cobra.Command, args []string) {
+	viper.BindPFlag("dry_run", cmd.Flags().Lookup("dry-run"))
+}
+
+func runCopy(cmd *cobra.Command, args []string) error {
+
+	log.Info().Strs("args", args).Msg("started copying")
+
+	if len(args) != 2 {
+		return errors.New("source and destination remote must be provided")
+	}
+
+	srcClient, srcRemote, err := config.NewS3ClientForRemote(args[0], "")
+	if err != nil {
+		return err
+	}
+
+	dstClient, dstRemote, err := config.NewS3ClientForRemote(args[1], "")
+	if err != nil {
+		return err
+	}
+
+	srcBucket, srcObject, err := s3.ParseRemote(srcRemote)
+	if err != nil {
+		return err
+	}
+
+	dstBucket, dstObject, err := s3.ParseRemote(dstRemote)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	var objects []minio.ObjectInfo
+
+	if srcObject == "" || strings.HasSuffix(srcObject, "/") {
+		if dstObject != "" && !strings.HasSuffix(dstObject, "/") {
+			return errors.New("a source prefix can only be copied to a destination prefix (ending in \"/\")")
+		}
+
+		objects, err = srcClient.ListObjects(ctx, srcBucket, srcObject)
+		if err != nil {
+			return err
+		}
+	} else {
+		objects = []minio.ObjectInfo{{Key: srcObject}}
+	}
+
+	dryRun := viper.GetBool("dry_run")
+	copied, skipped, failed := 0, 0, 0
+
+	for _, o := range objects {
+		target := destinationKey(o.Key, srcObject, dstObject)
+		src := fmt.Sprintf("s3://%s/%s", srcBucket, o.Key)
+		dst := fmt.Sprintf("s3://%s/%s", dstBucket, target)
+
+		copiedObject, err := copyObject(ctx, srcClient, dstClient, srcBucket, o.Key, dstBucket, target, dryRun)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL\t%s\t%s\n", src, err)
+			continue
+		}
+
+		if copiedObject == nil {
+			skipped++
+			fmt.Printf("SKIP\t%s\t%s (unchanged)\n", src, dst)
+			continue
+		}
+
+		copied++
+		if dryRun {
+			fmt.Printf("COPY\t%s\t%s (%s, dry run)\n", src, dst, humanize.IBytes(uint64(copiedObject.Size)))
+		} else {
+			fmt.Printf("COPY\t%s\t%s (%s)\n", src, dst, humanize.IBytes(uint64(copiedObject.Size)))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects failed to copy", failed, len(objects))
+	}
+
+	log.Info().Int("copied", copied).Int("skipped", skipped).Msg("finished copying")
+
+	return nil
+}
+
+// destinationKey places the key below the destination prefix, a destination prefix of a single object gets its base name
+func destinationKey(key string, srcObject string, dstObject string) string {
+	if dstObject != "" && !strings.HasSuffix(dstObject, "/") {
+		return dstObject
+	}
+
+	if key == srcObject {
+		return dstObject + path.Base(key)
+	}
+
+	return dstObject + strings.TrimPrefix(key, srcObject)
+}
+
+// copyObject copies a single object, unless the destination already holds the same content (nil is returned)
+func copyObject(ctx context.Context, srcClient *s3.S3Client, dstClient *s3.S3Client, srcBucket string, srcKey string, dstBucket string, dstKey string, dryRun bool) (*minio.ObjectInfo, error) {
+	source, err := srcClient.StatObject(ctx, srcBucket, srcKey)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := dstClient.StatObject(ctx, dstBucket, dstKey)
+	if err == nil && s3.SameContent(source, existing) {
+		return nil, nil
+	}
+
+	if err != nil && minio.ToErrorResponse(err).StatusCode != 404 {
+		return nil, err
+	}
+
+	if dryRun {
+		return &source, nil
+	}
+
+	err = srcClient.CopyObjectTo(ctx, dstClient, source, srcBucket, dstBucket, dstKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &source, nil
+}
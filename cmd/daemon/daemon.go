@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/daemon"
+	"github.com/scribblerockerz/parachute/pkg/job"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var DaemonCmd = &cobra.Command{
+	Use:    "daemon [JOB...] [flags]",
+	Short:  "Run the scheduled backup jobs of parachute.toml until SIGTERM",
+	RunE:   runDaemon,
+	PreRun: preRun,
+}
+
+func init() {
+	DaemonCmd.Flags().Duration("shutdown-timeout", 0, "time for running jobs to finish on shutdown, before they are cancelled")
+}
+
+// preRun will initialize viper flag bindings, to prevent overrides of the same key
+func preRun(cmd *cobra.Command, args []string) {
+	viper.BindPFlag("shutdown_timeout", cmd.Flags().Lookup("shutdown-timeout"))
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+
+	names := args
+	if len(names) == 0 {
+		names = job.Names()
+	}
+
+	if len(names) == 0 {
+		return errors.New("no jobs configured")
+	}
+
+	var jobs []*job.Job
+
+	for _, name := range names {
+		j, err := job.Load(name)
+		if err != nil {
+			return err
+		}
+
+		err = j.Validate()
+		if err != nil {
+			return err
+		}
+
+		jobs = append(jobs, j)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Info().Strs("jobs", names).Msg("started daemon")
+
+	return daemon.Run(ctx, jobs, viper.GetDuration("shutdown_timeout"))
+}
@@ -0,0 +1,200 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/logger"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var DiffCmd = &cobra.Command{
+	Use:    "diff SOURCE LOCAL [flags]",
+	Short:  "Show what would change in the LOCAL directory, if the REMOTE (S3) or local archive is restored into it",
+	RunE:   runDiff,
+	PreRun: preRun,
+}
+
+func init() {
+	DiffCmd.Flags().Bool("hash", false, "compare file contents (CRC32) instead of modification times")
+	DiffCmd.Flags().String("format", "text", "output format (text, json)")
+	DiffCmd.Flags().String("endpoint", "", "S3 endpoint")
+	DiffCmd.Flags().String("access-key", "", "S3 access key")
+	DiffCmd.Flags().String("secret-key", "", "S3 secret key")
+}
+
+// preRun will initialize viper flag bindings, to prevent overrides of the same key
+func preRun(cmd *cobra.Command, args []string) {
+	viper.BindPFlag("endpoint", cmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("access_key", cmd.Flags().Lookup("access-key"))
+	viper.BindPFlag("secret_key", cmd.Flags().Lookup("secret-key"))
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+
+	if format, _ := cmd.Flags().GetString("format"); format == "json" {
+		logger.UseStderr()
+	}
+
+	log.Info().Strs("args", args).Msg("started diff")
+
+	diffArgs, err := getDiffArgs(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	err = validateDiffInput(diffArgs)
+	if err != nil {
+		return err
+	}
+
+	archivePath := diffArgs.source
+
+	if config.IsRemote(diffArgs.source) {
+		tmp, err := os.MkdirTemp("", "parachute")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+
+		archivePath, err = download(diffArgs.source, tmp)
+		if err != nil {
+			return err
+		}
+	}
+
+	format, err := archive.DetectFileFormat(archivePath)
+	if err != nil {
+		return err
+	}
+
+	err = format.Extractable()
+	if err != nil {
+		return err
+	}
+
+	passphrase := ""
+	if format.IsEncrypted() {
+		if !config.HasPassphrase() {
+			return archive.ErrMissingKey
+		}
+
+		passphrase, err = config.Passphrase()
+		if err != nil {
+			return err
+		}
+	}
+
+	reader, err := archive.OpenZip(archivePath, format.IsEncrypted(), passphrase)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	changes, err := archive.DiffZip(&reader.Reader, diffArgs.destination, diffArgs.compareContent)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Int("changes", len(changes)).Msg("finished diff")
+
+	if diffArgs.format == "json" {
+		return printJSON(changes)
+	}
+
+	printText(changes)
+
+	return nil
+}
+
+func download(remote string, tmp string) (string, error) {
+	client, remote, err := config.NewS3ClientForRemote(remote, "")
+	if err != nil {
+		return "", err
+	}
+
+	downloadInfo, err := config.NewDownload(remote, path.Join(tmp, path.Base(remote)))
+	if err != nil {
+		return "", err
+	}
+
+	err = client.DownloadPayload(context.Background(), downloadInfo)
+	if err != nil {
+		return "", err
+	}
+
+	return downloadInfo.FilePath, nil
+}
+
+func printJSON(changes []archive.Change) error {
+	if changes == nil {
+		changes = []archive.Change{}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+
+	return encoder.Encode(changes)
+}
+
+func printText(changes []archive.Change) {
+	for _, change := range changes {
+		if change.Detail == "" {
+			fmt.Printf("%-8s\t%s\n", change.Kind, change.Path)
+			continue
+		}
+
+		fmt.Printf("%-8s\t%s\t(%s)\n", change.Kind, change.Path, change.Detail)
+	}
+}
+
+type diffArgs struct {
+	source         string
+	destination    string
+	compareContent bool
+	format         string
+}
+
+func getDiffArgs(cmd *cobra.Command, args []string) (*diffArgs, error) {
+	if len(args) != 2 {
+		return nil, errors.New("archive source and local directory must be provided")
+	}
+
+	compareContent, err := cmd.Flags().GetBool("hash")
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return nil, err
+	}
+
+	return &diffArgs{
+		source:         args[0],
+		destination:    args[1],
+		compareContent: compareContent,
+		format:         format,
+	}, nil
+}
+
+func validateDiffInput(diffArgs *diffArgs) error {
+	if diffArgs.format != "text" && diffArgs.format != "json" {
+		return fmt.Errorf("unsupported output format '%s' (text, json)", diffArgs.format)
+	}
+
+	if archive.IsDir(diffArgs.source) {
+		return errors.New("archive source must be a file or a remote")
+	}
+
+	return nil
+}
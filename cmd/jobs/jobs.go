@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/scribblerockerz/parachute/pkg/job"
+	"github.com/spf13/cobra"
+)
+
+var JobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "List the backup jobs configured in parachute.toml and their last run",
+	RunE:  runJobs,
+}
+
+func runJobs(cmd *cobra.Command, args []string) error {
+	jobs, err := job.LoadAll()
+	if err != nil {
+		return err
+	}
+
+	state, err := job.LoadState()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREMOTE\tLAST RUN\tSTATUS")
+
+	for _, j := range jobs {
+		lastRun := "never"
+		status := "-"
+
+		if runState, ok := state[j.Name]; ok {
+			lastRun = fmt.Sprintf("%s (%s)", runState.LastRun.Format(time.RFC3339), humanize.Time(runState.LastRun))
+			status = runState.Status
+
+			if runState.Error != "" {
+				status = fmt.Sprintf("%s: %s", status, runState.Error)
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", j.Name, strings.Join(j.AllRemotes(), ", "), lastRun, status)
+	}
+
+	return w.Flush()
+}
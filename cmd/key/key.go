@@ -0,0 +1,289 @@
+package key
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/keyring"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var KeyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage the repository key file (--key), whose data key encrypts the archives",
+}
+
+var initCmd = &cobra.Command{
+	Use:    "init [flags]",
+	Short:  "Create the key file with a new data key, sealed for the passphrase (--pass) and/or a public key (--recipient)",
+	RunE:   runInit,
+	PreRun: preRun,
+}
+
+var addCmd = &cobra.Command{
+	Use:    "add [flags]",
+	Short:  "Add a key slot for a new passphrase (--new-pass) or a public key (--recipient), unlocked by --pass or --identity",
+	RunE:   runAdd,
+	PreRun: preRun,
+}
+
+var removeCmd = &cobra.Command{
+	Use:   "remove SLOT",
+	Short: "Remove a key slot, unlocked by --pass or --identity",
+	RunE:  runRemove,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the key slots of the key file",
+	RunE:  runList,
+}
+
+var identityCmd = &cobra.Command{
+	Use:   "identity FILE",
+	Short: "Generate a private key FILE (identity) and print its public key for a key slot (--recipient)",
+	RunE:  runIdentity,
+}
+
+func init() {
+	KeyCmd.AddCommand(initCmd, addCmd, removeCmd, listCmd, identityCmd)
+
+	initCmd.Flags().String("recipient", "", "public key (base64) to seal the data key for")
+	initCmd.Flags().String("name", "", "name of the key slot")
+
+	addCmd.Flags().String("new-pass", "", "passphrase of the new key slot")
+	addCmd.Flags().String("recipient", "", "public key (base64) of the new key slot")
+	addCmd.Flags().String("name", "", "name of the key slot")
+}
+
+// preRun will initialize viper flag bindings, to prevent overrides of the same key
+func preRun(cmd *cobra.Command, args []string) {
+	viper.BindPFlag("recipient", cmd.Flags().Lookup("recipient"))
+	viper.BindPFlag("slot_name", cmd.Flags().Lookup("name"))
+	viper.BindPFlag("new_pass", cmd.Flags().Lookup("new-pass"))
+}
+
+func keyStore() (*config.KeyStore, error) {
+	if viper.GetString("key") == "" {
+		return nil, errors.New("remote of the key file must be provided (--key)")
+	}
+
+	return config.NewKeyStore(viper.GetString("key"), viper.GetString("target"))
+}
+
+// unlock loads the key file and opens it with the configured passphrase or identity
+func unlock(ctx context.Context, ks *config.KeyStore) (*keyring.KeyFile, []byte, error) {
+	k, err := ks.Load(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identity, err := config.LoadIdentity(viper.GetString("identity"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if viper.GetString("passphrase") == "" && identity == nil {
+		return nil, nil, errors.New("passphrase or identity is required to unlock the key file")
+	}
+
+	dataKey, err := k.Unlock(viper.GetString("passphrase"), identity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return k, dataKey, nil
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	ks, err := keyStore()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	// fails early, Save only creates the key file when it still does not exist
+	exists, err := ks.Exists(ctx)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return fmt.Errorf("key file '%s' already exists", ks.Remote)
+	}
+
+	if viper.GetString("passphrase") == "" && viper.GetString("recipient") == "" {
+		return errors.New("passphrase (--pass) or public key (--recipient) must be provided")
+	}
+
+	k, dataKey, err := keyring.New()
+	if err != nil {
+		return err
+	}
+
+	if viper.GetString("passphrase") != "" {
+		_, err = k.AddPassphrase(dataKey, viper.GetString("passphrase"), viper.GetString("slot_name"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if viper.GetString("recipient") != "" {
+		err = addRecipient(k, dataKey, viper.GetString("recipient"), viper.GetString("slot_name"))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ks.Save(ctx, k)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("key", ks.Remote).Msg("created key file")
+
+	return printSlots(k)
+}
+
+func runAdd(cmd *cobra.Command, args []string) error {
+	ks, err := keyStore()
+	if err != nil {
+		return err
+	}
+
+	if (viper.GetString("new_pass") == "") == (viper.GetString("recipient") == "") {
+		return errors.New("either a new passphrase (--new-pass) or a public key (--recipient) must be provided")
+	}
+
+	ctx := context.Background()
+
+	k, dataKey, err := unlock(ctx, ks)
+	if err != nil {
+		return err
+	}
+
+	if viper.GetString("new_pass") != "" {
+		_, err = k.AddPassphrase(dataKey, viper.GetString("new_pass"), viper.GetString("slot_name"))
+	} else {
+		err = addRecipient(k, dataKey, viper.GetString("recipient"), viper.GetString("slot_name"))
+	}
+	if err != nil {
+		return err
+	}
+
+	err = ks.Save(ctx, k)
+	if err != nil {
+		return err
+	}
+
+	return printSlots(k)
+}
+
+func runRemove(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("key slot must be provided")
+	}
+
+	ks, err := keyStore()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	k, _, err := unlock(ctx, ks)
+	if err != nil {
+		return err
+	}
+
+	err = k.Remove(args[0])
+	if err != nil {
+		return err
+	}
+
+	err = ks.Save(ctx, k)
+	if err != nil {
+		return err
+	}
+
+	return printSlots(k)
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	ks, err := keyStore()
+	if err != nil {
+		return err
+	}
+
+	k, err := ks.Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return printSlots(k)
+}
+
+func runIdentity(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("file of the private key must be provided")
+	}
+
+	if _, err := os.Stat(args[0]); err == nil {
+		return fmt.Errorf("identity '%s' already exists", args[0])
+	}
+
+	identity, err := keyring.GenerateIdentity()
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(args[0], []byte(keyring.EncodeIdentity(identity)+"\n"), 0600)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(keyring.EncodePublicKey(identity.PublicKey))
+
+	return nil
+}
+
+func addRecipient(k *keyring.KeyFile, dataKey []byte, recipient string, name string) error {
+	publicKey, err := keyring.ParsePublicKey(recipient)
+	if err != nil {
+		return err
+	}
+
+	_, err = k.AddPublicKey(dataKey, publicKey, name)
+
+	return err
+}
+
+func printSlots(k *keyring.KeyFile) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLOT\tTYPE\tNAME\tCREATED")
+
+	for _, slot := range k.Slots {
+		name := slot.Name
+		if name == "" {
+			name = "-"
+		}
+
+		if slot.Type == keyring.SLOT_PUBLIC_KEY {
+			var recipient [32]byte
+			copy(recipient[:], slot.Recipient)
+			name = fmt.Sprintf("%s (%s)", name, keyring.EncodePublicKey(recipient))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", slot.ID, slot.Type, name, slot.Created.Local().Format(time.RFC3339))
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,114 @@
+package list
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/scribblerockerz/parachute/pkg/catalog"
+	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/s3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var ListCmd = &cobra.Command{
+	Use:    "list REMOTE [flags]",
+	Short:  "List the backups below a remote prefix, or the versions of a remote object",
+	RunE:   runList,
+	PreRun: preRun,
+}
+
+func init() {
+	ListCmd.Flags().Bool("versions", false, "list the version history of the remote object (versioned buckets)")
+}
+
+// preRun will initialize viper flag bindings, to prevent overrides of the same key
+func preRun(cmd *cobra.Command, args []string) {
+	viper.BindPFlag("versions", cmd.Flags().Lookup("versions"))
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("remote must be provided")
+	}
+
+	client, remote, err := config.NewS3ClientForRemote(args[0], "")
+	if err != nil {
+		return err
+	}
+
+	bucket, object, err := s3.ParseRemote(remote)
+	if err != nil {
+		return err
+	}
+
+	if viper.GetBool("versions") {
+		return listVersions(client, bucket, object)
+	}
+
+	return listBackups(client, bucket, object)
+}
+
+func listBackups(client *s3.S3Client, bucket string, prefix string) error {
+	backups, err := catalog.List(context.Background(), client, bucket, prefix)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REMOTE\tCREATED\tSIZE\tJOB\tTAGS")
+
+	for _, b := range backups {
+		job := b.Job
+		if job == "" {
+			job = "-"
+		}
+
+		tags := strings.Join(b.Tags, ",")
+		if tags == "" {
+			tags = "-"
+		}
+
+		fmt.Fprintf(w, "s3://%s/%s\t%s\t%s\t%s\t%s\n", bucket, b.Key, b.Created.Local().Format(time.RFC3339), humanize.IBytes(uint64(b.Size)), job, tags)
+	}
+
+	return w.Flush()
+}
+
+func listVersions(client *s3.S3Client, bucket string, object string) error {
+	if object == "" || strings.HasSuffix(object, "/") {
+		return errors.New("versions can only be listed for an exact remote object")
+	}
+
+	versions, err := client.ListVersions(context.Background(), bucket, object)
+	if err != nil {
+		return err
+	}
+
+	if len(versions) == 0 {
+		return fmt.Errorf("remote object 's3://%s/%s' has no versions", bucket, object)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION ID\tLAST MODIFIED\tSIZE\tSTATE")
+
+	for _, v := range versions {
+		state := "noncurrent"
+		if v.IsLatest {
+			state = "current"
+		}
+		if v.IsDeleteMarker {
+			state += " (delete marker)"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.VersionID, v.LastModified.Local().Format(time.RFC3339), humanize.IBytes(uint64(v.Size)), state)
+	}
+
+	return w.Flush()
+}
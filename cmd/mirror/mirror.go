@@ -0,0 +1,174 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/mirror"
+	"github.com/scribblerockerz/parachute/pkg/rekey"
+	"github.com/scribblerockerz/parachute/pkg/s3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var MirrorCmd = &cobra.Command{
+	Use:    "mirror REMOTE LOCAL [flags]",
+	Short:  "Download the backups below a REMOTE prefix (S3), which are not yet present in the LOCAL directory",
+	RunE:   runMirror,
+	PreRun: preRun,
+}
+
+func init() {
+	MirrorCmd.Flags().Int("keep", 0, "keep only the newest N backups in the local directory (0 keeps all)")
+	MirrorCmd.Flags().Bool("dry-run", false, "only print the backups which would be downloaded or removed")
+}
+
+// preRun will initialize viper flag bindings, to prevent overrides of the same key
+func preRun(cmd *cobra.Command, args []string) {
+	viper.BindPFlag("keep", cmd.Flags().Lookup("keep"))
+	viper.BindPFlag("dry_run", cmd.Flags().Lookup("dry-run"))
+}
+
+func runMirror(cmd *cobra.Command, args []string) error {
+
+	log.Info().Strs("args", args).Msg("started mirroring")
+
+	if len(args) != 2 {
+		return errors.New("remote and local directory must be provided")
+	}
+
+	keep := viper.GetInt("keep")
+	if keep < 0 {
+		return errors.New("keep must not be negative")
+	}
+
+	client, remote, err := config.NewS3ClientForRemote(args[0], "")
+	if err != nil {
+		return err
+	}
+
+	bucket, prefix, err := s3.ParseRemote(remote)
+	if err != nil {
+		return err
+	}
+
+	dir := args[1]
+	dryRun := viper.GetBool("dry_run")
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	state, err := mirror.LoadState(dir)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	listed, err := client.ListObjects(ctx, bucket, prefix)
+	if err != nil {
+		return err
+	}
+
+	objects := map[string]minio.ObjectInfo{}
+
+	for _, o := range listed {
+		if prefix != "" && !strings.HasSuffix(prefix, "/") && o.Key != prefix {
+			continue
+		}
+
+		// left over copies of interrupted copy and rekey runs are no backups
+		if strings.HasSuffix(o.Key, s3.COPY_SUFFIX) || strings.HasSuffix(o.Key, rekey.TEMP_SUFFIX) {
+			continue
+		}
+
+		name, err := mirror.LocalName(o.Key, prefix)
+		if err != nil {
+			return err
+		}
+
+		objects[name] = o
+	}
+
+	retained, expired := mirror.Retain(state, objects, keep)
+	mirrored, skipped, failed := 0, 0, 0
+
+	for _, name := range retained {
+		o, ok := objects[name]
+		if !ok {
+			// removed from the remote, the local copy is kept
+			continue
+		}
+
+		src := fmt.Sprintf("s3://%s/%s", bucket, o.Key)
+		localPath := mirror.LocalPath(dir, name)
+
+		if state.Current(dir, name, o) {
+			skipped++
+			continue
+		}
+
+		if dryRun {
+			mirrored++
+			fmt.Printf("MIRROR\t%s\t%s (%s, dry run)\n", src, localPath, humanize.IBytes(uint64(o.Size)))
+			continue
+		}
+
+		entry, err := mirror.Fetch(ctx, client, bucket, o, localPath)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL\t%s\t%s\n", src, err)
+			continue
+		}
+
+		state[name] = entry
+		mirrored++
+		fmt.Printf("MIRROR\t%s\t%s (%s)\n", src, localPath, humanize.IBytes(uint64(entry.Size)))
+
+		err = state.Save(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range expired {
+		localPath := mirror.LocalPath(dir, name)
+
+		if dryRun {
+			fmt.Printf("REMOVE\t%s (exceeds retention, dry run)\n", localPath)
+			continue
+		}
+
+		err = os.Remove(localPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		delete(state, name)
+		fmt.Printf("REMOVE\t%s (exceeds retention)\n", localPath)
+	}
+
+	if !dryRun {
+		err = state.Save(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d backups failed to mirror", failed, mirrored+skipped+failed)
+	}
+
+	log.Info().Int("mirrored", mirrored).Int("skipped", skipped).Int("removed", len(expired)).Msg("finished mirroring")
+
+	return nil
+}
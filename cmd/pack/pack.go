@@ -1,36 +1,59 @@
 package pack
 
 import (
+	"bufio"
+	"context"
 	"errors"
-	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/logger"
+	"github.com/scribblerockerz/parachute/pkg/naming"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var PackCmd = &cobra.Command{
-	Use:    "pack SOURCE [flags]",
-	Short:  "Create an archive of a file/directory.",
+	Use:    "pack SOURCE... [flags]",
+	Short:  "Create an archive of a file/directory. Use \"-\" to read the sources from stdin.",
 	RunE:   runPack,
 	PreRun: preRun,
 }
 
 func init() {
-	PackCmd.Flags().StringP("output", "o", "", "output destination")
+	PackCmd.Flags().StringP("output", "o", "", "output destination, \"-\" writes the archive to stdout")
 	PackCmd.Flags().Bool("timed-name", false, "prepend sortable time infront of the archive")
+	PackCmd.Flags().String("files-from", "", "read sources from a file (\"-\" for stdin), one path per line")
+	PackCmd.Flags().String("files-from0", "", "read sources from a file (\"-\" for stdin), separated by NUL characters")
+	PackCmd.Flags().String("base-dir", "", "directory to resolve relative paths of the file list against")
+	PackCmd.Flags().StringArray("source", nil, "source stored under an alias inside of the archive (path:alias)")
+	PackCmd.Flags().Bool("preserve-paths", false, "store sources under their absolute path instead of their base name")
+	PackCmd.Flags().String("name", "", "name of the archive (default is the source name or \"package\")")
 }
 
 // preRun will initialize viper flag bindings, to prevent overrides of the same key
 func preRun(cmd *cobra.Command, args []string) {
 	viper.BindPFlag("output", cmd.Flags().Lookup("output"))
 	viper.BindPFlag("timed_name", cmd.Flags().Lookup("timed-name"))
+	viper.BindPFlag("files_from", cmd.Flags().Lookup("files-from"))
+	viper.BindPFlag("files_from0", cmd.Flags().Lookup("files-from0"))
+	viper.BindPFlag("base_dir", cmd.Flags().Lookup("base-dir"))
+	viper.BindPFlag("source", cmd.Flags().Lookup("source"))
+	viper.BindPFlag("preserve_paths", cmd.Flags().Lookup("preserve-paths"))
+	viper.BindPFlag("name", cmd.Flags().Lookup("name"))
 }
 
 func runPack(cmd *cobra.Command, args []string) error {
 
+	if viper.GetString("output") == archive.STDIO {
+		logger.UseStderr()
+	}
+
 	log.Info().Strs("args", args).Msg("started packing")
 
 	err := validatePackInput(args)
@@ -43,18 +66,40 @@ func runPack(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	fmt.Println(packArgs.destination)
-	fmt.Println(viper.GetString("output"))
+	passphrase := ""
+	if !viper.GetBool("no_encryption") {
+		passphrase, err = config.Passphrase()
+		if err != nil {
+			return err
+		}
+	}
 
 	a, err := archive.CreateArchiveFromSources(
+		context.Background(),
 		packArgs.source,
 		!viper.GetBool("no_encryption"),
-		viper.GetString("passphrase"),
+		passphrase,
+		archive.ZipOptions{
+			PreservePaths: viper.GetBool("preserve_paths"),
+			Name:          packArgs.name,
+		},
 	)
 	if err != nil {
 		return err
 	}
 
+	if packArgs.destination == archive.STDIO {
+		defer a.RemoveTempLocation()
+
+		err = writeToStdout(a.TempDestination())
+		if err != nil {
+			return err
+		}
+
+		log.Info().Msg("finished packing archive to stdout")
+		return nil
+	}
+
 	fileDestination, err := a.CopyIntoDir(a.TempDestination(), packArgs.destination, viper.GetBool("timed_name"))
 	if err != nil {
 		return err
@@ -70,12 +115,23 @@ func runPack(cmd *cobra.Command, args []string) error {
 }
 
 type packArgs struct {
-	source      []string
+	source      []archive.Source
 	destination string
+	name        string
 }
 
 func getPackArgs(args []string, output string) (*packArgs, error) {
-	pathArg := output
+	vars := naming.Vars{Time: time.Now()}
+
+	pathArg, err := naming.Expand(output, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := naming.Expand(viper.GetString("name"), vars)
+	if err != nil {
+		return nil, err
+	}
 
 	if pathArg == "" {
 		cwd, err := os.Getwd()
@@ -87,18 +143,82 @@ func getPackArgs(args []string, output string) (*packArgs, error) {
 		pathArg = cwd
 	}
 
+	if len(args) == 1 && args[0] == archive.STDIO {
+		args, err = readSourcesFrom(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(args) == 0 {
+			return nil, errors.New("no sources provided on stdin")
+		}
+	}
+
+	aliasSources, err := archive.ParseAliasSources(viper.GetStringSlice("source"))
+	if err != nil {
+		return nil, err
+	}
+
+	fileListSources, err := config.FileListSources()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := archive.ParseSources(args)
+	sources = append(sources, aliasSources...)
+	sources = append(sources, fileListSources...)
+
 	return &packArgs{
-		source:      args,
+		source:      sources,
 		destination: pathArg,
+		name:        name,
 	}, nil
 }
 
+// readSourcesFrom reads one source per line, empty lines are ignored
+func readSourcesFrom(r io.Reader) ([]string, error) {
+	var sources []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		sources = append(sources, line)
+	}
+
+	return sources, scanner.Err()
+}
+
+func writeToStdout(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(os.Stdout, f)
+	return err
+}
+
 func validatePackInput(args []string) error {
-	if len(args) == 0 {
+	usesFileList := viper.GetString("files_from") != "" || viper.GetString("files_from0") != ""
+
+	if len(args) == 0 && !usesFileList && len(viper.GetStringSlice("source")) == 0 {
 		return errors.New("source file or directory must be provided")
 	}
 
-	if !viper.GetBool("no_encryption") && viper.GetString("passphrase") == "" {
+	if strings.Contains(viper.GetString("name"), "/") {
+		return errors.New("archive name must be a plain file name")
+	}
+
+	if len(args) == 1 && args[0] == archive.STDIO && config.ReadsFileListFromStdin() {
+		return errors.New("stdin can only be read once")
+	}
+
+	if !viper.GetBool("no_encryption") && !config.HasPassphrase() {
 		return errors.New("provided passphrase is empty")
 	}
 
@@ -0,0 +1,136 @@
+package rekey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/rekey"
+	"github.com/scribblerockerz/parachute/pkg/s3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var RekeyCmd = &cobra.Command{
+	Use:    "rekey REMOTE [flags]",
+	Short:  "Re-encrypt encrypted backups (S3) with a new passphrase, a REMOTE ending in \"/\" re-encrypts every backup below the prefix",
+	RunE:   runRekey,
+	PreRun: preRun,
+}
+
+func init() {
+	RekeyCmd.Flags().String("old-pass", "", "current passphrase of the backups")
+	RekeyCmd.Flags().String("new-pass", "", "new passphrase of the backups, or of the key file with --key")
+	RekeyCmd.Flags().Bool("dry-run", false, "only print the backups which would be re-encrypted")
+}
+
+// preRun will initialize viper flag bindings, to prevent overrides of the same key
+func preRun(cmd *cobra.Command, args []string) {
+	viper.BindPFlag("old_pass", cmd.Flags().Lookup("old-pass"))
+	viper.BindPFlag("new_pass", cmd.Flags().Lookup("new-pass"))
+	viper.BindPFlag("dry_run", cmd.Flags().Lookup("dry-run"))
+}
+
+func runRekey(cmd *cobra.Command, args []string) error {
+
+	log.Info().Strs("args", args).Msg("started rekeying")
+
+	if len(args) != 1 {
+		return errors.New("remote must be provided")
+	}
+
+	oldPassphrase := viper.GetString("old_pass")
+	newPassphrase := viper.GetString("new_pass")
+
+	if oldPassphrase == "" || (newPassphrase == "" && (viper.GetString("key") == "" || viper.GetString("identity") == "")) {
+		return errors.New("old and new passphrase must be provided")
+	}
+
+	// with a key file, the backups are re-encrypted with its data key, unlocked by the new passphrase or the identity
+	newPassphrase, err := config.ArchivePassphrase(newPassphrase, viper.GetString("key"), viper.GetString("identity"), viper.GetString("target"))
+	if err != nil {
+		return err
+	}
+
+	if oldPassphrase == newPassphrase {
+		return errors.New("new passphrase must differ from the old one")
+	}
+
+	client, remote, err := config.NewS3ClientForRemote(args[0], "")
+	if err != nil {
+		return err
+	}
+
+	bucket, object, err := s3.ParseRemote(remote)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	keys := []string{object}
+
+	if object == "" || strings.HasSuffix(object, "/") {
+		objects, err := client.ListObjects(ctx, bucket, object)
+		if err != nil {
+			return err
+		}
+
+		// encrypted backups are detected from their content, left over copies of interrupted runs are replaced
+		keys = nil
+		for _, o := range objects {
+			if !strings.HasSuffix(o.Key, rekey.TEMP_SUFFIX) {
+				keys = append(keys, o.Key)
+			}
+		}
+	}
+
+	dryRun := viper.GetBool("dry_run")
+	rekeyed, skipped, failed := 0, 0, 0
+
+	for _, key := range keys {
+		src := fmt.Sprintf("s3://%s/%s", bucket, key)
+
+		var size int64
+
+		if dryRun {
+			var info minio.ObjectInfo
+			info, err = rekey.Check(ctx, client, bucket, key, oldPassphrase, newPassphrase)
+			size = info.Size
+		} else {
+			size, err = rekey.Rekey(ctx, client, bucket, key, oldPassphrase, newPassphrase)
+		}
+
+		if errors.Is(err, rekey.ErrAlreadyRekeyed) || errors.Is(err, rekey.ErrNotEncrypted) {
+			skipped++
+			fmt.Printf("SKIP\t%s (%s)\n", src, err)
+			continue
+		}
+
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL\t%s\t%s\n", src, err)
+			continue
+		}
+
+		rekeyed++
+		if dryRun {
+			fmt.Printf("REKEY\t%s (%s, dry run)\n", src, humanize.IBytes(uint64(size)))
+		} else {
+			fmt.Printf("REKEY\t%s (%s)\n", src, humanize.IBytes(uint64(size)))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d backups failed to re-encrypt", failed, len(keys))
+	}
+
+	log.Info().Int("rekeyed", rekeyed).Int("skipped", skipped).Msg("finished rekeying")
+
+	return nil
+}
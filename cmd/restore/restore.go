@@ -4,28 +4,47 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path"
 	"strings"
+	"time"
 
+	"github.com/minio/minio-go/v7"
 	"github.com/rs/zerolog/log"
 	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/scribblerockerz/parachute/pkg/catalog"
 	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/hook"
+	"github.com/scribblerockerz/parachute/pkg/job"
+	"github.com/scribblerockerz/parachute/pkg/logger"
+	"github.com/scribblerockerz/parachute/pkg/naming"
 	"github.com/scribblerockerz/parachute/pkg/s3"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var RestoreCmd = &cobra.Command{
-	Use:    "restore LOCAL [flags]",
+	Use:    "restore [LOCAL] [flags]",
 	Short:  "Restore an REMOTE archive (encrypted) from an S3 source and move it to a LOCAL destination",
 	RunE:   runRestore,
 	PreRun: preRun,
 }
 
 func init() {
-	RestoreCmd.Flags().StringP("remote", "o", "", "remote destination (S3)")
+	RestoreCmd.Flags().StringArrayP("remote", "o", nil, "remote source (S3), repeat to fall back to replicas in the given order")
 	RestoreCmd.Flags().String("endpoint", "", "S3 endpoint")
 	RestoreCmd.Flags().String("access-key", "", "S3 access key")
 	RestoreCmd.Flags().String("secret-key", "", "S3 secret key")
+	RestoreCmd.Flags().String("job", "", "use remote, passphrase and hooks of the configured job")
+	RestoreCmd.Flags().Int("download-concurrency", 0, "amount of parallel ranged requests while downloading")
+	RestoreCmd.Flags().Bool("stdout", false, "write the file of a single file backup to stdout")
+	RestoreCmd.Flags().Bool("latest", false, "restore the latest backup below the remote prefix")
+	RestoreCmd.Flags().String("at", "", "restore the latest backup below the remote prefix, which is not newer than the given time")
+	RestoreCmd.Flags().String("tag", "", "restore the latest backup below the remote prefix with the given tag")
+	RestoreCmd.Flags().String("version-id", "", "restore a specific version of the remote object")
+	RestoreCmd.Flags().String("version-before", "", "restore the latest version of the remote object, which is not newer than the given time")
+	RestoreCmd.Flags().Int("strip-components", 0, "remove leading path components of the extracted entries")
+	RestoreCmd.Flags().StringArray("map", nil, "move extracted entries below a prefix to another location (from=to)")
 }
 
 // preRun will initialize viper flag bindings, to prevent overrides of the same key
@@ -34,120 +53,373 @@ func preRun(cmd *cobra.Command, args []string) {
 	viper.BindPFlag("access_key", cmd.Flags().Lookup("access-key"))
 	viper.BindPFlag("secret_key", cmd.Flags().Lookup("secret-key"))
 	viper.BindPFlag("remote", cmd.Flags().Lookup("remote"))
+	viper.BindPFlag("job", cmd.Flags().Lookup("job"))
+	viper.BindPFlag("download_concurrency", cmd.Flags().Lookup("download-concurrency"))
+	viper.BindPFlag("stdout", cmd.Flags().Lookup("stdout"))
+	viper.BindPFlag("latest", cmd.Flags().Lookup("latest"))
+	viper.BindPFlag("at", cmd.Flags().Lookup("at"))
+	viper.BindPFlag("tag", cmd.Flags().Lookup("tag"))
+	viper.BindPFlag("version_id", cmd.Flags().Lookup("version-id"))
+	viper.BindPFlag("version_before", cmd.Flags().Lookup("version-before"))
+	viper.BindPFlag("strip_components", cmd.Flags().Lookup("strip-components"))
+	viper.BindPFlag("map", cmd.Flags().Lookup("map"))
 }
 
 func runRestore(cmd *cobra.Command, args []string) error {
 
+	if viper.GetBool("stdout") {
+		logger.UseStderr()
+	}
+
 	log.Info().Strs("args", args).Msg("started restoring")
 
-	err := validateRestoreInput(args, viper.GetString("remote"))
+	restoreArgs, err := getRestoreArgs(args, viper.GetStringSlice("remote"), viper.GetString("job"))
 	if err != nil {
 		return err
 	}
 
-	restoreArgs, err := getRestoreArgs(args, viper.GetString("remote"))
+	err = validateRestoreInput(restoreArgs)
 	if err != nil {
 		return err
 	}
 
-	err = config.ValidateS3Configuration()
-	if err != nil {
-		return err
+	env := map[string]string{
+		"PARACHUTE_JOB":         restoreArgs.jobName,
+		"PARACHUTE_REMOTE":      restoreArgs.remotes[0],
+		"PARACHUTE_DESTINATION": restoreArgs.destination,
 	}
 
-	client, err := s3.NewClient(
-		viper.GetString("endpoint"),
-		viper.GetString("access_key"),
-		viper.GetString("secret_key"),
-		true,
-	)
-
+	err = restoreArgs.hooks.Run(context.Background(), hook.PRE_RESTORE, env)
 	if err != nil {
+		restoreArgs.hooks.RunOnFailure(env, err)
 		return err
 	}
 
-	a, err := archive.CreateTempArchiveFromRemoteFile(restoreArgs.remote)
-
+	fileDestination, servedBy, err := restore(restoreArgs)
 	if err != nil {
+		restoreArgs.hooks.RunOnFailure(env, err)
 		return err
 	}
 
-	downloadInfo, err := s3.NewDownload(restoreArgs.remote, a.TempDestination())
+	env["PARACHUTE_STATUS"] = job.STATUS_SUCCESS
+	env["PARACHUTE_REMOTE"] = servedBy
+	env["PARACHUTE_DESTINATION"] = fileDestination
+
+	err = restoreArgs.hooks.Run(context.Background(), hook.POST_RESTORE, env)
 	if err != nil {
+		restoreArgs.hooks.RunOnFailure(env, err)
 		return err
 	}
 
-	log.Debug().Str("bucket", downloadInfo.Bucket).Str("object", downloadInfo.Object).Str("filePath", downloadInfo.FilePath).Msg("started downloading")
+	log.Info().Str("destination", fileDestination).Msg("finsihed restore to destination")
+
+	return nil
+}
 
-	err = client.DownloadPayload(
-		context.Background(),
-		downloadInfo,
-	)
+func restore(restoreArgs *restoreArgs) (string, string, error) {
+	a, servedBy, err := fetchBackup(restoreArgs)
+	if err != nil {
+		return "", "", err
+	}
 
+	format, err := a.Detect()
 	if err != nil {
-		return err
+		a.RemoveTempLocation()
+		return "", "", fmt.Errorf("unable to restore '%s': %s", servedBy, err)
 	}
 
-	log.Debug().Str("bucket", downloadInfo.Bucket).Str("object", downloadInfo.Object).Str("temdDestination", a.TempDestination()).Msg("finished downloading")
+	log.Debug().Str("remote", servedBy).Str("format", string(format)).Msg("detected archive format")
+
+	if a.IsEncrupted && !restoreArgs.hasPassphrase() {
+		a.RemoveTempLocation()
+		return "", "", fmt.Errorf("unable to restore '%s': %w", servedBy, archive.ErrMissingKey)
+	}
 
 	if a.IsEncrupted {
-		err = a.Decrypt(viper.GetString("passphrase"))
+		passphrase, err := config.ArchivePassphrase(restoreArgs.passphrase, restoreArgs.key, restoreArgs.identity, restoreArgs.target)
 		if err != nil {
-			return err
+			return "", "", err
+		}
+
+		err = a.Decrypt(passphrase)
+		if err != nil {
+			return "", "", err
 		}
 
 		log.Debug().Str("decryptedFile", a.TempDestination()).Msg("decrypted temporary archive")
 	}
 
-	err = a.Unzip()
+	if restoreArgs.destination == archive.STDIO {
+		defer a.RemoveTempLocation()
+
+		err = a.WriteSingleEntry(os.Stdout)
+		if err != nil {
+			return "", "", err
+		}
+
+		return archive.STDIO, servedBy, nil
+	}
+
+	err = a.Unzip(restoreArgs.extract)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
 	fileDestination, err := a.CopyIntoDir(a.Destination(), restoreArgs.destination, false)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
 	err = a.Cleanup()
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
-	log.Info().Str("destination", fileDestination).Msg("finsihed restore to destination")
+	return fileDestination, servedBy, nil
+}
 
-	return nil
+// errStaleReplica marks a replica, whose data differs from the newest copy of the backup
+var errStaleReplica = errors.New("replica is stale")
+
+// replica is a remote resolved to the object, which it would serve for the restore
+type replica struct {
+	client *s3.S3Client
+	remote string
+	info   minio.ObjectInfo
+}
+
+// created is the time the backup was uploaded to the replica
+func (r *replica) created() time.Time {
+	if created, err := time.Parse(time.RFC3339, r.info.UserMetadata[s3.METADATA_CREATED]); err == nil {
+		return created
+	}
+
+	return r.info.LastModified
+}
+
+// fetchBackup downloads the backup from the first replica, which is reachable and up to date. Replicas are tried
+// lazily in the given order, unavailable replicas and replicas serving a stale or corrupted copy are skipped. Only
+// replicas reached so far are compared, a later replica is never contacted while an earlier one serves the backup.
+func fetchBackup(restoreArgs *restoreArgs) (*archive.Archive, string, error) {
+	var reached []*replica
+	var lastErr error
+
+	for _, remote := range restoreArgs.remotes {
+		r, err := resolveReplica(remote, restoreArgs)
+		if err != nil {
+			if !isUnavailable(err) {
+				return nil, "", err
+			}
+
+			log.Warn().Err(err).Str("remote", remote).Msg("replica is unavailable, trying next")
+			lastErr = err
+			continue
+		}
+
+		reached = append(reached, r)
+		expected := expectedChecksum(reached)
+
+		if stored := r.info.UserMetadata[s3.METADATA_SHA256]; expected != "" && stored != "" && stored != expected {
+			lastErr = fmt.Errorf("%w: '%s' holds sha256 %s, expected %s", errStaleReplica, r.remote, stored, expected)
+			log.Warn().Err(lastErr).Msg("replica is stale, trying next")
+			continue
+		}
+
+		a, err := download(r, expected)
+		if err != nil {
+			if !isUnavailable(err) && !errors.Is(err, errStaleReplica) {
+				return nil, "", err
+			}
+
+			log.Warn().Err(err).Str("remote", r.remote).Msg("download from replica failed, trying next")
+			lastErr = err
+			continue
+		}
+
+		if len(restoreArgs.remotes) > 1 {
+			log.Info().Str("remote", r.remote).Msg("restored from replica")
+		}
+
+		return a, r.remote, nil
+	}
+
+	return nil, "", lastErr
 }
 
-func validateRestoreInput(args []string, remote string) error {
-	if len(args) != 1 {
-		return errors.New("archive destination must be provided")
+// resolveReplica selects the backup and version of the remote and fetches its object info
+func resolveReplica(remote string, restoreArgs *restoreArgs) (*replica, error) {
+	client, remote, err := config.NewS3ClientForRemote(remote, restoreArgs.target)
+	if err != nil {
+		return nil, err
 	}
 
-	if !viper.GetBool("no_encryption") && viper.GetString("passphrase") == "" {
-		return errors.New("provided passphrase is empty")
+	if restoreArgs.selects() {
+		remote, err = selectBackup(client, remote, restoreArgs)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if viper.GetBool("no_encryption") {
-		log.Warn().Msg("no encryption requested")
+	bucket, object, err := s3.ParseRemote(remote)
+	if err != nil {
+		return nil, err
 	}
 
-	if remote == "" {
-		return errors.New("remote source must be provided")
+	versionID, err := selectVersion(client, bucket, object, restoreArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := client.StatObjectVersion(context.Background(), bucket, object, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &replica{client: client, remote: remote, info: info}, nil
+}
+
+// expectedChecksum is the stored sha256 of the newest backup among the reached replicas, empty if none is known
+func expectedChecksum(replicas []*replica) string {
+	var newest *replica
+
+	for _, r := range replicas {
+		if r.info.UserMetadata[s3.METADATA_SHA256] == "" {
+			continue
+		}
+
+		if newest == nil || r.created().After(newest.created()) {
+			newest = r
+		}
+	}
+
+	if newest == nil {
+		return ""
+	}
+
+	return newest.info.UserMetadata[s3.METADATA_SHA256]
+}
+
+// download fetches the replica into a temporary archive and compares the data with the expected checksum
+func download(r *replica, expected string) (*archive.Archive, error) {
+	a, err := archive.CreateTempArchiveFromRemoteFile(r.remote)
+	if err != nil {
+		return nil, err
+	}
+
+	downloadInfo, err := config.NewDownload(r.remote, a.TempDestination())
+	if err != nil {
+		return nil, err
+	}
+
+	downloadInfo.VersionID = r.info.VersionID
+
+	log.Debug().Str("bucket", downloadInfo.Bucket).Str("object", downloadInfo.Object).Str("filePath", downloadInfo.FilePath).Msg("started downloading")
+
+	err = r.client.DownloadPayload(context.Background(), downloadInfo)
+	if err != nil {
+		a.RemoveTempLocation()
+		return nil, err
+	}
+
+	log.Debug().Str("bucket", downloadInfo.Bucket).Str("object", downloadInfo.Object).Str("temdDestination", a.TempDestination()).Msg("finished downloading")
+
+	if expected == "" {
+		return a, nil
+	}
+
+	checksums, err := archive.FileChecksums(a.TempDestination())
+	if err != nil {
+		a.RemoveTempLocation()
+		return nil, err
+	}
+
+	if checksums.SHA256Hex() != expected {
+		a.RemoveTempLocation()
+		return nil, fmt.Errorf("%w: data of '%s' has sha256 %s, expected %s", errStaleReplica, r.remote, checksums.SHA256Hex(), expected)
+	}
+
+	return a, nil
+}
+
+// isUnavailable reports errors, which another replica may not have
+func isUnavailable(err error) bool {
+	return s3.IsUnavailable(err) || errors.Is(err, catalog.ErrNoBackup)
+}
+
+// selectBackup picks the backup below the prefix of the remote. Exact remotes select between their timed variants,
+// templated remotes below the path in front of the first placeholder.
+func selectBackup(client *s3.S3Client, remote string, restoreArgs *restoreArgs) (string, error) {
+	bucket, object, err := s3.ParseRemote(remote)
+	if err != nil {
+		return "", err
+	}
+
+	filter := catalog.Filter{
+		At:  restoreArgs.at,
+		Job: restoreArgs.jobName,
+		Tag: restoreArgs.tag,
+	}
+
+	prefix := object
+
+	if naming.HasPlaceholders(object) {
+		prefix = naming.StaticPrefix(object)
+	} else if !strings.HasSuffix(object, "/") {
+		prefix, filter.Name = path.Split(object)
 	}
 
-	if !strings.HasPrefix(remote, "s3://") {
-		return errors.New("remote must be declared in \"s3://bucket/some-path\" format")
+	b, err := catalog.Select(context.Background(), client, bucket, prefix, filter)
+	if err != nil {
+		return "", err
+	}
+
+	log.Info().Str("remote", fmt.Sprintf("s3://%s/%s", bucket, b.Key)).Time("created", b.Created).Msg("selected backup")
+
+	return fmt.Sprintf("s3://%s/%s", bucket, b.Key), nil
+}
+
+// selectVersion returns the requested version of the object, an empty version is the current one
+func selectVersion(client *s3.S3Client, bucket string, object string, restoreArgs *restoreArgs) (string, error) {
+	if restoreArgs.versionBefore.IsZero() {
+		return restoreArgs.versionID, nil
+	}
+
+	versions, err := client.ListVersions(context.Background(), bucket, object)
+	if err != nil {
+		return "", err
+	}
+
+	for _, v := range versions {
+		if v.IsDeleteMarker || v.LastModified.After(restoreArgs.versionBefore) {
+			continue
+		}
+
+		log.Info().Str("remote", fmt.Sprintf("s3://%s/%s", bucket, object)).Str("version", v.VersionID).Time("modified", v.LastModified).Msg("selected version")
+
+		return v.VersionID, nil
 	}
 
-	isEncrypted := archive.IsFileEncrypted(remote)
+	return "", fmt.Errorf("no version of 's3://%s/%s' before %s", bucket, object, restoreArgs.versionBefore.Format(time.RFC3339))
+}
 
-	if isEncrypted && viper.GetString("passphrase") == "" {
-		return fmt.Errorf("remote object contains encryption hint (%s) but passphrase is empty", archive.ENCRYPTED_FILE_SUFFIX)
+func validateRestoreInput(restoreArgs *restoreArgs) error {
+	if len(restoreArgs.remotes) == 0 {
+		return errors.New("remote source must be provided")
 	}
 
-	if isEncrypted && viper.GetBool("no_encryption") {
-		log.Warn().Str("remote", remote).Msg(fmt.Sprintf("remote object contains encryption hint (%s) but configured to 'not encrypt'", archive.ENCRYPTED_FILE_SUFFIX))
+	if restoreArgs.versionID != "" && !restoreArgs.versionBefore.IsZero() {
+		return errors.New("either version-id or version-before can be used, not both")
+	}
+
+	if (restoreArgs.versionID != "" || !restoreArgs.versionBefore.IsZero()) && restoreArgs.selects() {
+		return errors.New("versions can only be restored from an exact remote object")
+	}
+
+	// whether a backup is encrypted is detected from its content after the download
+	for _, remote := range restoreArgs.remotes {
+		if remote == "" {
+			return errors.New("remote source must not be empty")
+		}
 	}
 
 	return nil
@@ -155,12 +427,132 @@ func validateRestoreInput(args []string, remote string) error {
 
 type restoreArgs struct {
 	destination string
-	remote      string
+	remotes     []string
+	target      string
+	passphrase  string
+	key         string
+	identity    string
+	jobName     string
+	hooks       *hook.Hooks
+	extract     archive.ExtractOptions
+
+	// latest, at and tag select a backup below the remote prefix
+	latest bool
+	at     time.Time
+	tag    string
+
+	// versionID or versionBefore select a version of the remote object
+	versionID     string
+	versionBefore time.Time
+}
+
+// hasPassphrase is true, when a passphrase or an identity unlocking the key file is provided
+func (r *restoreArgs) hasPassphrase() bool {
+	return r.passphrase != "" || (r.key != "" && r.identity != "")
 }
 
-func getRestoreArgs(args []string, remote string) (*restoreArgs, error) {
-	return &restoreArgs{
-		destination: args[0],
-		remote:      remote,
-	}, nil
+// selects is true, when the remotes address a prefix to select a backup from
+func (r *restoreArgs) selects() bool {
+	if r.latest || !r.at.IsZero() || r.tag != "" {
+		return true
+	}
+
+	for _, remote := range r.remotes {
+		if strings.HasSuffix(remote, "/") || naming.HasPlaceholders(remote) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getRestoreArgs collects the restore options, a job provides defaults for remotes, target, passphrase, key and hooks
+func getRestoreArgs(args []string, remotes []string, jobName string) (*restoreArgs, error) {
+	var destination string
+
+	if viper.GetBool("stdout") {
+		if len(args) != 0 {
+			return nil, errors.New("archive destination can not be combined with --stdout")
+		}
+
+		destination = archive.STDIO
+	} else {
+		if len(args) != 1 {
+			return nil, errors.New("archive destination must be provided")
+		}
+
+		destination = args[0]
+	}
+
+	extract, err := config.ExtractOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var at time.Time
+	if viper.GetString("at") != "" {
+		at, err = catalog.ParseTime(viper.GetString("at"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var versionBefore time.Time
+	if viper.GetString("version_before") != "" {
+		versionBefore, err = catalog.ParseTime(viper.GetString("version_before"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	restoreArgs := &restoreArgs{
+		destination: destination,
+		extract:     extract,
+		latest:      viper.GetBool("latest"),
+		at:          at,
+		tag:         viper.GetString("tag"),
+		remotes:     remotes,
+		target:      viper.GetString("target"),
+		passphrase:  viper.GetString("passphrase"),
+		key:         viper.GetString("key"),
+		identity:    viper.GetString("identity"),
+		jobName:     jobName,
+
+		versionID:     viper.GetString("version_id"),
+		versionBefore: versionBefore,
+	}
+
+	if jobName == "" {
+		return restoreArgs, nil
+	}
+
+	j, err := job.Load(jobName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(restoreArgs.remotes) == 0 {
+		restoreArgs.remotes = j.AllRemotes()
+	}
+
+	// explicit flags take precedence over the job
+	if restoreArgs.target == "" {
+		restoreArgs.target = j.Target
+	}
+
+	if restoreArgs.passphrase == "" {
+		restoreArgs.passphrase = j.Passphrase
+	}
+
+	if restoreArgs.key == "" {
+		restoreArgs.key = j.Key
+	}
+
+	if restoreArgs.identity == "" {
+		restoreArgs.identity = j.Identity
+	}
+
+	restoreArgs.hooks = &j.Hooks
+
+	return restoreArgs, nil
 }
@@ -5,10 +5,21 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/scribblerockerz/parachute/cmd/backup"
+	"github.com/scribblerockerz/parachute/cmd/copy"
+	"github.com/scribblerockerz/parachute/cmd/daemon"
+	"github.com/scribblerockerz/parachute/cmd/diff"
+	"github.com/scribblerockerz/parachute/cmd/jobs"
+	"github.com/scribblerockerz/parachute/cmd/key"
+	"github.com/scribblerockerz/parachute/cmd/list"
+	"github.com/scribblerockerz/parachute/cmd/mirror"
 	"github.com/scribblerockerz/parachute/cmd/pack"
+	"github.com/scribblerockerz/parachute/cmd/rekey"
 	"github.com/scribblerockerz/parachute/cmd/restore"
+	"github.com/scribblerockerz/parachute/cmd/run"
 	"github.com/scribblerockerz/parachute/cmd/unpack"
+	"github.com/scribblerockerz/parachute/cmd/verify"
 	"github.com/scribblerockerz/parachute/cmd/version"
+	"github.com/scribblerockerz/parachute/pkg/archive"
 	"github.com/scribblerockerz/parachute/pkg/config"
 	"github.com/scribblerockerz/parachute/pkg/logger"
 	"github.com/spf13/cobra"
@@ -44,12 +55,30 @@ func init() {
 	rootCmd.AddCommand(restore.RestoreCmd)
 	rootCmd.AddCommand(pack.PackCmd)
 	rootCmd.AddCommand(unpack.UnpackCmd)
+	rootCmd.AddCommand(verify.VerifyCmd)
+	rootCmd.AddCommand(diff.DiffCmd)
+	rootCmd.AddCommand(run.RunCmd)
+	rootCmd.AddCommand(jobs.JobsCmd)
+	rootCmd.AddCommand(list.ListCmd)
+	rootCmd.AddCommand(copy.CopyCmd)
+	rootCmd.AddCommand(mirror.MirrorCmd)
+	rootCmd.AddCommand(rekey.RekeyCmd)
+	rootCmd.AddCommand(key.KeyCmd)
+	rootCmd.AddCommand(daemon.DaemonCmd)
 	rootCmd.AddCommand(version.VersionCmd)
 
 	rootCmd.SilenceUsage = true
 	rootCmd.SilenceErrors = true
 	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
 		logger.SetupLogger(viper.GetString("log_level"), viper.GetString("log_format"))
+
+		kdf, err := archive.ParseKDF(viper.GetString("kdf"))
+		if err != nil {
+			return err
+		}
+
+		archive.SetKDF(kdf)
+
 		return nil
 	}
 
@@ -59,9 +88,17 @@ func init() {
 	rootCmd.PersistentFlags().String("log-format", "", "logging format (console, json)")
 	rootCmd.PersistentFlags().BoolP("no-encryption", "E", false, "prevent archive encryption")
 	rootCmd.PersistentFlags().StringP("pass", "p", "", "encryption passphrase")
+	rootCmd.PersistentFlags().String("kdf", "", "key derivation of new encrypted archives (openssl, pbkdf2[:iterations=N], scrypt[:n=N,r=R,p=P], argon2id[:time=T,memory=KiB,threads=T])")
+	rootCmd.PersistentFlags().StringP("target", "t", "", "storage target of parachute.toml to use")
+	rootCmd.PersistentFlags().String("key", "", "remote of the repository key file, its data key encrypts the archives")
+	rootCmd.PersistentFlags().String("identity", "", "private key file unlocking a public key slot of the repository key file")
 
 	viper.BindPFlag("log_level", rootCmd.PersistentFlags().Lookup("log-level"))
 	viper.BindPFlag("log_format", rootCmd.PersistentFlags().Lookup("log-format"))
 	viper.BindPFlag("no_encryption", rootCmd.PersistentFlags().Lookup("no-encryption"))
 	viper.BindPFlag("passphrase", rootCmd.PersistentFlags().Lookup("pass"))
+	viper.BindPFlag("kdf", rootCmd.PersistentFlags().Lookup("kdf"))
+	viper.BindPFlag("target", rootCmd.PersistentFlags().Lookup("target"))
+	viper.BindPFlag("key", rootCmd.PersistentFlags().Lookup("key"))
+	viper.BindPFlag("identity", rootCmd.PersistentFlags().Lookup("identity"))
 }
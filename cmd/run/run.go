@@ -0,0 +1,96 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/job"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var RunCmd = &cobra.Command{
+	Use:    "run JOB... [flags]",
+	Short:  "Run the backup JOBs configured in parachute.toml",
+	RunE:   runRun,
+	PreRun: preRun,
+}
+
+func init() {
+	RunCmd.Flags().Bool("all", false, "run all configured jobs")
+	RunCmd.Flags().String("endpoint", "", "S3 endpoint")
+	RunCmd.Flags().String("access-key", "", "S3 access key")
+	RunCmd.Flags().String("secret-key", "", "S3 secret key")
+}
+
+// preRun will initialize viper flag bindings, to prevent overrides of the same key
+func preRun(cmd *cobra.Command, args []string) {
+	viper.BindPFlag("endpoint", cmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("access_key", cmd.Flags().Lookup("access-key"))
+	viper.BindPFlag("secret_key", cmd.Flags().Lookup("secret-key"))
+}
+
+func runRun(cmd *cobra.Command, args []string) error {
+
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+
+	names, err := getJobNames(args, all)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]*job.Job, len(names))
+	for i, name := range names {
+		jobs[i], err = job.Load(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+
+	for _, j := range jobs {
+		log.Info().Str("job", j.Name).Msg("started job")
+
+		result, err := j.RunAndRecord(context.Background())
+		if err != nil {
+			failed++
+			log.Error().Str("job", j.Name).Err(err).Msg("job failed")
+			continue
+		}
+
+		log.Info().Str("job", j.Name).Str("destination", result.Remote).Msg("finished job")
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed", failed, len(jobs))
+	}
+
+	return nil
+}
+
+func getJobNames(args []string, all bool) ([]string, error) {
+	if all && len(args) > 0 {
+		return nil, errors.New("either job names or --all must be provided, not both")
+	}
+
+	if !all {
+		if len(args) == 0 {
+			return nil, errors.New("job name must be provided")
+		}
+
+		return args, nil
+	}
+
+	names := job.Names()
+	if len(names) == 0 {
+		return nil, errors.New("no jobs configured")
+	}
+
+	return names, nil
+}
@@ -2,18 +2,19 @@ package unpack
 
 import (
 	"errors"
+	"fmt"
 	"os"
-	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/scribblerockerz/parachute/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var UnpackCmd = &cobra.Command{
 	Use:    "unpack SOURCE [flags]",
-	Short:  "Extract an (encrypted) archive to a file/directory.",
+	Short:  "Extract an (encrypted) archive to a file/directory. Use \"-\" to read the archive from stdin.",
 	RunE:   runUnpack,
 	PreRun: preRun,
 }
@@ -21,38 +22,46 @@ var UnpackCmd = &cobra.Command{
 func init() {
 	UnpackCmd.Flags().StringP("output", "o", "", "output destination")
 	UnpackCmd.Flags().Bool("timed-name", false, "prepend sortable time infront of the archive")
+	UnpackCmd.Flags().Int("strip-components", 0, "remove leading path components of the extracted entries")
+	UnpackCmd.Flags().StringArray("map", nil, "move extracted entries below a prefix to another location (from=to)")
 }
 
 // preRun will initialize viper flag bindings, to prevent overrides of the same key
 func preRun(cmd *cobra.Command, args []string) {
 	viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+	viper.BindPFlag("strip_components", cmd.Flags().Lookup("strip-components"))
+	viper.BindPFlag("map", cmd.Flags().Lookup("map"))
 }
 
 func runUnpack(cmd *cobra.Command, args []string) error {
 
 	err := validateUnpackInput(args)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	unpackArgs, err := getUnpackArgs(args, viper.GetString("output"))
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	a, err := archive.CreateTempArchiveFromRemoteFile(unpackArgs.source)
-
+	a, err := createTempArchive(unpackArgs.source)
 	if err != nil {
 		return err
 	}
 
-	_, err = a.CopyIntoDir(unpackArgs.source, a.TempLocation, false)
-	if err != nil {
-		return err
+	if a.IsEncrupted && !config.HasPassphrase() {
+		a.RemoveTempLocation()
+		return archive.ErrMissingKey
 	}
 
 	if a.IsEncrupted {
-		err = a.Decrypt(viper.GetString("passphrase"))
+		passphrase, err := config.Passphrase()
+		if err != nil {
+			return err
+		}
+
+		err = a.Decrypt(passphrase)
 		if err != nil {
 			return err
 		}
@@ -60,7 +69,7 @@ func runUnpack(cmd *cobra.Command, args []string) error {
 		log.Debug().Str("decryptedFile", a.TempDestination()).Msg("decrypted temporary archive")
 	}
 
-	err = a.Unzip()
+	err = a.Unzip(unpackArgs.extract)
 	if err != nil {
 		return err
 	}
@@ -80,9 +89,51 @@ func runUnpack(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// createTempArchive copies the source archive into a temporary location, whether it is encrypted
+// is detected from its content
+func createTempArchive(source string) (*archive.Archive, error) {
+	var a *archive.Archive
+	var err error
+
+	r := os.Stdin
+
+	if source == archive.STDIO {
+		a, err = archive.CreateTempArchive("stdin", false)
+	} else {
+		a, err = archive.CreateTempArchiveFromRemoteFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if source != archive.STDIO {
+		r, err = os.Open(source)
+		if err != nil {
+			a.RemoveTempLocation()
+			return nil, err
+		}
+		defer r.Close()
+	}
+
+	err = a.Store(r)
+	if err != nil {
+		a.RemoveTempLocation()
+		return nil, err
+	}
+
+	_, err = a.Detect()
+	if err != nil {
+		a.RemoveTempLocation()
+		return nil, fmt.Errorf("unable to unpack '%s': %s", source, err)
+	}
+
+	return a, nil
+}
+
 type unpackArgs struct {
 	source      string
 	destination string
+	extract     archive.ExtractOptions
 }
 
 func getUnpackArgs(args []string, output string) (*unpackArgs, error) {
@@ -98,9 +149,15 @@ func getUnpackArgs(args []string, output string) (*unpackArgs, error) {
 		pathArg = cwd
 	}
 
+	extract, err := config.ExtractOptions()
+	if err != nil {
+		return nil, err
+	}
+
 	return &unpackArgs{
 		source:      args[0],
 		destination: pathArg,
+		extract:     extract,
 	}, nil
 }
 
@@ -109,9 +166,5 @@ func validateUnpackInput(args []string) error {
 		return errors.New("source archive must be provided")
 	}
 
-	if strings.HasSuffix(args[0], archive.ENCRYPTED_FILE_SUFFIX) && viper.GetString("passphrase") == "" {
-		return errors.New("provided passphrase is empty")
-	}
-
 	return nil
 }
@@ -0,0 +1,256 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+
+	"github.com/dustin/go-humanize"
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/s3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var VerifyCmd = &cobra.Command{
+	Use:    "verify SOURCE [flags]",
+	Short:  "Verify that a REMOTE (S3) or local archive can be restored, without extracting any files",
+	RunE:   runVerify,
+	PreRun: preRun,
+}
+
+func init() {
+	VerifyCmd.Flags().Int("sample", 0, "verify N random backups below the given remote prefix")
+	VerifyCmd.Flags().String("endpoint", "", "S3 endpoint")
+	VerifyCmd.Flags().String("access-key", "", "S3 access key")
+	VerifyCmd.Flags().String("secret-key", "", "S3 secret key")
+}
+
+// preRun will initialize viper flag bindings, to prevent overrides of the same key
+func preRun(cmd *cobra.Command, args []string) {
+	viper.BindPFlag("endpoint", cmd.Flags().Lookup("endpoint"))
+	viper.BindPFlag("access_key", cmd.Flags().Lookup("access-key"))
+	viper.BindPFlag("secret_key", cmd.Flags().Lookup("secret-key"))
+}
+
+type verifyResult struct {
+	source string
+	report *archive.VerifyReport
+	err    error
+}
+
+func (r *verifyResult) ok() bool {
+	return r.err == nil && r.report.Ok()
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+
+	log.Info().Strs("args", args).Msg("started verification")
+
+	sample, err := cmd.Flags().GetInt("sample")
+	if err != nil {
+		return err
+	}
+
+	err = validateVerifyInput(args, sample)
+	if err != nil {
+		return err
+	}
+
+	source := args[0]
+
+	var results []*verifyResult
+
+	if !config.IsRemote(source) {
+		results = append(results, verifyLocal(source))
+	} else {
+		client, remote, err := config.NewS3ClientForRemote(source, "")
+		if err != nil {
+			return err
+		}
+
+		remotes := []string{remote}
+
+		if sample > 0 {
+			remotes, err = sampleRemotes(client, remote, sample)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, remote := range remotes {
+			results = append(results, verifyRemote(client, remote))
+		}
+	}
+
+	failed := printReport(results)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d backups failed verification", failed, len(results))
+	}
+
+	log.Info().Int("backups", len(results)).Msg("finished verification")
+
+	return nil
+}
+
+func validateVerifyInput(args []string, sample int) error {
+	if len(args) != 1 {
+		return errors.New("archive source must be provided")
+	}
+
+	if sample < 0 {
+		return errors.New("sample size must not be negative")
+	}
+
+	if sample > 0 && !config.IsRemote(args[0]) {
+		return errors.New("sampling requires a remote prefix in \"s3://bucket/some-prefix/\" format")
+	}
+
+	return nil
+}
+
+func sampleRemotes(client *s3.S3Client, prefix string, sample int) ([]string, error) {
+	bucket, objectPrefix, err := s3.ParseRemote(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := client.ListObjects(context.Background(), bucket, objectPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no backups found below '%s'", prefix)
+	}
+
+	rand.Shuffle(len(objects), func(i, j int) {
+		objects[i], objects[j] = objects[j], objects[i]
+	})
+
+	if sample > len(objects) {
+		sample = len(objects)
+	}
+
+	remotes := make([]string, sample)
+	for i := range remotes {
+		remotes[i] = fmt.Sprintf("s3://%s/%s", bucket, objects[i].Key)
+	}
+
+	return remotes, nil
+}
+
+func verifyLocal(source string) *verifyResult {
+	result := &verifyResult{source: source}
+	result.report, result.err = verifyFile(source)
+
+	return result
+}
+
+func verifyRemote(client *s3.S3Client, remote string) *verifyResult {
+	result := &verifyResult{source: remote}
+
+	tmp, err := os.MkdirTemp("", "parachute")
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer os.RemoveAll(tmp)
+
+	downloadInfo, err := config.NewDownload(remote, path.Join(tmp, path.Base(remote)))
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	info, err := client.StatObject(context.Background(), downloadInfo.Bucket, downloadInfo.Object)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	err = client.DownloadPayload(context.Background(), downloadInfo)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	if stored := info.UserMetadata[s3.METADATA_SHA256]; stored != "" {
+		checksums, err := archive.FileChecksums(downloadInfo.FilePath)
+		if err != nil {
+			result.err = err
+			return result
+		}
+
+		if checksums.SHA256Hex() != stored {
+			result.err = fmt.Errorf("SHA-256 %s does not match the stored checksum %s", checksums.SHA256Hex(), stored)
+			return result
+		}
+
+		log.Debug().Str("remote", remote).Str("sha256", stored).Msg("verified stored checksum")
+	}
+
+	result.report, result.err = verifyFile(downloadInfo.FilePath)
+
+	return result
+}
+
+func verifyFile(filePath string) (*archive.VerifyReport, error) {
+	format, err := archive.DetectFileFormat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = format.Extractable()
+	if err != nil {
+		return nil, err
+	}
+
+	isEncrypted := format.IsEncrypted()
+
+	if isEncrypted && !config.HasPassphrase() {
+		return nil, archive.ErrMissingKey
+	}
+
+	passphrase := ""
+	if isEncrypted {
+		passphrase, err = config.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return archive.VerifyArchive(filePath, isEncrypted, passphrase)
+}
+
+// printReport prints a line per verified backup and returns the amount of failed ones
+func printReport(results []*verifyResult) int {
+	failed := 0
+
+	for _, result := range results {
+		if result.ok() {
+			fmt.Printf("OK\t%s\t%d entries, %s\n", result.source, result.report.Entries, humanize.Bytes(uint64(result.report.Bytes)))
+			continue
+		}
+
+		failed++
+
+		if result.err != nil {
+			fmt.Printf("FAIL\t%s\t%s\n", result.source, result.err)
+			continue
+		}
+
+		fmt.Printf("FAIL\t%s\t%d of %d entries are corrupt\n", result.source, len(result.report.Errors), result.report.Entries)
+		for _, entryErr := range result.report.Errors {
+			fmt.Printf("\t%s\n", entryErr)
+		}
+	}
+
+	return failed
+}
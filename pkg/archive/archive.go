@@ -1,8 +1,11 @@
 package archive
 
 import (
+	"archive/zip"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"strings"
@@ -12,12 +15,22 @@ import (
 )
 
 const DEFAULT_FILE_PERMISSIONS = 0755
+const TIMED_NAME_FORMAT = "20060102150405"
+
+// STDIO as source or output reads from stdin or writes to stdout
+const STDIO = "-"
 
 type Archive struct {
 	TempLocation string
 	IsEncrupted  bool
 
-	fileName string
+	fileName  string
+	checksums *Checksums
+}
+
+// Checksums of the final temporary archive, calculated while it was built
+func (a *Archive) Checksums() *Checksums {
+	return a.checksums
 }
 
 func (a *Archive) TempDestination() string {
@@ -39,12 +52,90 @@ func (a *Archive) encZipDestination() string {
 	return path.Join(a.TempLocation, fmt.Sprintf("%s%s", a.fileName, ".zip.enc"))
 }
 
-func (a *Archive) Zip(sources []string) error {
-	return ZipSource(sources, a.zipDestination())
+func (a *Archive) Zip(ctx context.Context, sources []Source, options ZipOptions) error {
+	if a.IsEncrupted {
+		return ZipSource(ctx, sources, a.zipDestination(), options)
+	}
+
+	return a.writeWithChecksums(a.zipDestination(), func(w io.Writer) error {
+		return ZipSourceTo(ctx, sources, w, options)
+	})
 }
 
-func (a *Archive) Unzip() error {
-	return UnzipSource(a.zipDestination(), a.Destination())
+// writeWithChecksums creates the file and calculates the checksums of everything written into it
+func (a *Archive) writeWithChecksums(filePath string, write func(w io.Writer) error) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	checksum := newChecksumWriter()
+
+	err = write(io.MultiWriter(f, checksum))
+	if err != nil {
+		return err
+	}
+
+	a.checksums = checksum.Checksums()
+
+	return f.Close()
+}
+
+func (a *Archive) Unzip(options ExtractOptions) error {
+	return UnzipSource(a.zipDestination(), a.Destination(), options)
+}
+
+// WriteSingleEntry writes the content of an archive with exactly one file into the writer
+func (a *Archive) WriteSingleEntry(w io.Writer) error {
+	reader, err := zip.OpenReader(a.zipDestination())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var entry *zip.File
+
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		if entry != nil {
+			return errors.New("archive contains more than a single file")
+		}
+
+		entry = f
+	}
+
+	if entry == nil {
+		return errors.New("archive contains no file")
+	}
+
+	r, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// Store writes the (encrypted) archive of the reader into the temporary location
+func (a *Archive) Store(r io.Reader) error {
+	f, err := os.Create(a.TempDestination())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
 }
 
 func (a *Archive) Encrypt(passphrase string) error {
@@ -52,7 +143,9 @@ func (a *Archive) Encrypt(passphrase string) error {
 		log.Warn().Msg("provided passphrase is empty")
 	}
 
-	return EncryptFile(a.zipDestination(), a.encZipDestination(), passphrase)
+	return a.writeWithChecksums(a.encZipDestination(), func(w io.Writer) error {
+		return EncryptFileTo(a.zipDestination(), w, passphrase)
+	})
 }
 
 func (a *Archive) Decrypt(passphrase string) error {
@@ -63,6 +156,32 @@ func (a *Archive) Decrypt(passphrase string) error {
 	return DecryptFile(a.encZipDestination(), a.zipDestination(), passphrase)
 }
 
+// Detect determines from the content of the temporary archive whether it is encrypted, regardless of its name,
+// and moves it to the matching temporary destination. Plain archives have to be zip archives.
+func (a *Archive) Detect() (Format, error) {
+	format, err := DetectFileFormat(a.TempDestination())
+	if err != nil {
+		return format, err
+	}
+
+	err = format.Extractable()
+	if err != nil {
+		return format, err
+	}
+
+	if format.IsEncrypted() != a.IsEncrupted {
+		current := a.TempDestination()
+		a.IsEncrupted = format.IsEncrypted()
+
+		err = os.Rename(current, a.TempDestination())
+		if err != nil {
+			return format, err
+		}
+	}
+
+	return format, nil
+}
+
 func (a *Archive) Cleanup() error {
 	if a.IsEncrupted {
 		err := os.Remove(a.encZipDestination())
@@ -83,6 +202,11 @@ func (a *Archive) Cleanup() error {
 	return nil
 }
 
+// RemoveTempLocation removes the temporary location of the archive with everything in it
+func (a *Archive) RemoveTempLocation() error {
+	return os.RemoveAll(a.TempLocation)
+}
+
 func (a *Archive) CopyIntoDir(source string, destination string, useTimedName bool) (string, error) {
 	destination, err := ensureValidDestination(destination)
 	if err != nil {
@@ -91,7 +215,7 @@ func (a *Archive) CopyIntoDir(source string, destination string, useTimedName bo
 
 	fileName := path.Base(source)
 	if useTimedName {
-		fileName = fmt.Sprintf("%s_%s", time.Now().Format("20060102150405"), fileName)
+		fileName = TimedName(fileName, time.Now())
 	}
 
 	destinationFilePath := path.Join(destination, fileName)
@@ -111,6 +235,11 @@ func (a *Archive) CopyIntoDir(source string, destination string, useTimedName bo
 	return destinationFilePath, nil
 }
 
+// TimedName prepends a sortable time in front of the file name
+func TimedName(fileName string, t time.Time) string {
+	return fmt.Sprintf("%s_%s", t.Format(TIMED_NAME_FORMAT), fileName)
+}
+
 func ensureValidDestination(destination string) (string, error) {
 	var err error
 
@@ -128,7 +257,10 @@ func ensureValidDestination(destination string) (string, error) {
 	}
 
 	if notExists {
-		os.Mkdir(destination, DEFAULT_FILE_PERMISSIONS)
+		err = os.MkdirAll(destination, DEFAULT_FILE_PERMISSIONS)
+		if err != nil {
+			return "", err
+		}
 	}
 
 	if !notExists && !fileInfo.IsDir() {
@@ -138,18 +270,18 @@ func ensureValidDestination(destination string) (string, error) {
 	return destination, nil
 }
 
-func CreateArchiveFromSources(sources []string, useEncryption bool, passphrase string) (*Archive, error) {
+func CreateArchiveFromSources(ctx context.Context, sources []Source, useEncryption bool, passphrase string, options ZipOptions) (*Archive, error) {
 	tmp, err := tempLocation()
 
 	if err != nil {
 		return nil, err
 	}
 
-	var fileName string
+	fileName := options.Name
 
-	if len(sources) == 1 {
-		fileName = path.Base(sources[0])
-	} else {
+	if fileName == "" && len(sources) == 1 {
+		fileName = sources[0].baseName()
+	} else if fileName == "" {
 		fileName = "package"
 	}
 
@@ -163,8 +295,9 @@ func CreateArchiveFromSources(sources []string, useEncryption bool, passphrase s
 		fileName:     fileName,
 	}
 
-	err = a.Zip(sources)
-	if err != err {
+	err = a.Zip(ctx, sources, options)
+	if err != nil {
+		a.RemoveTempLocation()
 		return nil, err
 	}
 
@@ -173,7 +306,8 @@ func CreateArchiveFromSources(sources []string, useEncryption bool, passphrase s
 	if a.IsEncrupted {
 		err = a.Encrypt(passphrase)
 
-		if err != err {
+		if err != nil {
+			a.RemoveTempLocation()
 			return nil, err
 		}
 
@@ -207,6 +341,20 @@ func CreateTempArchiveFromRemoteFile(remoteObjectPath string) (*Archive, error)
 	}, nil
 }
 
+// CreateTempArchive prepares an empty temporary archive, to be filled by Store
+func CreateTempArchive(fileName string, isEncrypted bool) (*Archive, error) {
+	tmp, err := tempLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Archive{
+		TempLocation: tmp,
+		IsEncrupted:  isEncrypted,
+		fileName:     fileName,
+	}, nil
+}
+
 func tempLocation() (string, error) {
 	return os.MkdirTemp("/tmp", "parachute")
 }
@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Checksums of a final (encrypted) archive, as it is stored remotely
+type Checksums struct {
+	Size   int64
+	SHA256 []byte
+	CRC32C uint32
+}
+
+func (c *Checksums) SHA256Hex() string {
+	return hex.EncodeToString(c.SHA256)
+}
+
+func (c *Checksums) SHA256Base64() string {
+	return base64.StdEncoding.EncodeToString(c.SHA256)
+}
+
+func (c *Checksums) CRC32CBase64() string {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, c.CRC32C)
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// checksumWriter calculates all checksums of the data written through it
+type checksumWriter struct {
+	sha256 hash.Hash
+	crc32c hash.Hash32
+	size   int64
+}
+
+func newChecksumWriter() *checksumWriter {
+	return &checksumWriter{
+		sha256: sha256.New(),
+		crc32c: crc32.New(crc32.MakeTable(crc32.Castagnoli)),
+	}
+}
+
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	w.sha256.Write(p)
+	w.crc32c.Write(p)
+	w.size += int64(len(p))
+	return len(p), nil
+}
+
+func (w *checksumWriter) Checksums() *Checksums {
+	return &Checksums{
+		Size:   w.size,
+		SHA256: w.sha256.Sum(nil),
+		CRC32C: w.crc32c.Sum32(),
+	}
+}
+
+func ReaderChecksums(r io.Reader) (*Checksums, error) {
+	w := newChecksumWriter()
+
+	_, err := io.Copy(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.Checksums(), nil
+}
+
+func FileChecksums(filePath string) (*Checksums, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReaderChecksums(f)
+}
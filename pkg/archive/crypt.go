@@ -1,50 +1,280 @@
 package archive
 
 import (
-	"io/ioutil"
-	"log"
-
-	openssl "github.com/Luzifer/go-openssl/v4"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 )
 
+// OPENSSL_SALT_HEADER starts archives in the OpenSSL compatible format, followed by the 8 byte salt
+const OPENSSL_SALT_HEADER = "Salted__"
+
 func EncryptFile(sourcePath string, targetPath string, passphrase string) error {
-	plainText, err := ioutil.ReadFile(sourcePath)
+	f, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	o := openssl.New()
+	err = EncryptFileTo(sourcePath, f, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
 
-	cipherText, err := o.EncryptBinaryBytes(passphrase, []byte(plainText), openssl.PBKDF2SHA256)
+// EncryptFileTo writes the encrypted content of the source file into the writer
+func EncryptFileTo(sourcePath string, w io.Writer, passphrase string) error {
+	f, err := os.Open(sourcePath)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	err = ioutil.WriteFile(targetPath, cipherText, 0777)
+	encrypted, err := NewEncryptWriter(w, passphrase)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = io.Copy(encrypted, f)
+	if err != nil {
+		return err
+	}
+
+	return encrypted.Close()
 }
 
 func DecryptFile(sourcePath string, targetPath string, passphrase string) error {
-	cipherText, err := ioutil.ReadFile(sourcePath)
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	plain, err := NewDecryptReader(f, passphrase)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	o := openssl.New()
+	out, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
 
-	plainText, err := o.DecryptBinaryBytes(passphrase, []byte(cipherText), openssl.PBKDF2SHA256)
+	_, err = io.Copy(out, plain)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(targetPath, plainText, 0777)
+	return out.Close()
+}
+
+func DecryptBytes(cipherText []byte, passphrase string) ([]byte, error) {
+	plain, err := NewDecryptReader(bytes.NewReader(cipherText), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(plain)
+}
+
+// encryptWriter encrypts a stream with AES-256-CBC, in the OpenSSL compatible format unless another KDF is configured
+type encryptWriter struct {
+	w       io.Writer
+	mode    cipher.BlockMode
+	pending []byte
+}
+
+// NewEncryptWriter encrypts everything written into w with the configured KDF (SetKDF), Close writes the padded final block
+func NewEncryptWriter(w io.Writer, passphrase string) (io.WriteCloser, error) {
+	kdf, err := defaultKDF.withSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	key, iv, err := kdf.derive(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = kdf.writeHeader(w)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{w: w, mode: cipher.NewCBCEncrypter(block, iv)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	e.pending = append(e.pending, p...)
+
+	full := len(e.pending) - len(e.pending)%aes.BlockSize
+	if full == 0 {
+		return len(p), nil
+	}
+
+	out := make([]byte, full)
+	e.mode.CryptBlocks(out, e.pending[:full])
+	e.pending = append(e.pending[:0], e.pending[full:]...)
+
+	_, err := e.w.Write(out)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (e *encryptWriter) Close() error {
+	padding := aes.BlockSize - len(e.pending)
+	final := append(e.pending, bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	e.mode.CryptBlocks(final, final)
+	e.pending = nil
+
+	_, err := e.w.Write(final)
+	return err
+}
+
+// decryptReader decrypts a stream written by EncryptFile or NewEncryptWriter. The last block is held back until
+// the end of the stream, to remove and check its padding.
+type decryptReader struct {
+	r       io.Reader
+	mode    cipher.BlockMode
+	pending []byte
+	plain   []byte
+	eof     bool
+}
+
+// NewDecryptReader decrypts the stream of r with the KDF of its header, a wrong passphrase fails with an invalid
+// padding at the end of the stream
+func NewDecryptReader(r io.Reader, passphrase string) (io.Reader, error) {
+	kdf, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, iv, err := kdf.derive(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{r: r, mode: cipher.NewCBCDecrypter(block, iv)}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.eof {
+			return 0, io.EOF
+		}
+
+		err := d.fill()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+
+	return n, nil
+}
+
+// fill decrypts all complete blocks read so far, except the last one
+func (d *decryptReader) fill() error {
+	buf := make([]byte, 32*1024)
+
+	n, err := d.r.Read(buf)
+	d.pending = append(d.pending, buf[:n]...)
+
+	if err == io.EOF {
+		d.eof = true
+
+		if len(d.pending) == 0 || len(d.pending)%aes.BlockSize != 0 {
+			return fmt.Errorf("encrypted data has an invalid length")
+		}
+
+		d.mode.CryptBlocks(d.pending, d.pending)
+
+		padding := int(d.pending[len(d.pending)-1])
+		if padding == 0 || padding > aes.BlockSize || !bytes.Equal(d.pending[len(d.pending)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+			return errors.New("unable to decrypt data, invalid padding (wrong passphrase?)")
+		}
+
+		d.plain = d.pending[:len(d.pending)-padding]
+		d.pending = nil
+
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
+	full := len(d.pending) - len(d.pending)%aes.BlockSize
+	if full == len(d.pending) {
+		full -= aes.BlockSize
+	}
+	if full <= 0 {
+		return nil
+	}
+
+	d.plain = make([]byte, full)
+	d.mode.CryptBlocks(d.plain, d.pending[:full])
+	d.pending = append(d.pending[:0], d.pending[full:]...)
+
 	return nil
 }
+
+// OpensWith checks cheaply whether the passphrase decrypts an encrypted zip archive, using only its head (header and
+// first block) and its last 32 bytes: the first block has to start with a zip signature and the last block has to
+// carry a valid padding
+func OpensWith(head []byte, tail []byte, passphrase string) bool {
+	r := bytes.NewReader(head)
+
+	kdf, err := readHeader(r)
+	if err != nil || r.Len() < aes.BlockSize || len(tail) < 2*aes.BlockSize {
+		return false
+	}
+
+	key, iv, err := kdf.derive(passphrase)
+	if err != nil {
+		return false
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return false
+	}
+
+	firstBlock := head[len(head)-r.Len():][:aes.BlockSize]
+
+	first := make([]byte, aes.BlockSize)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(first, firstBlock)
+
+	if !bytes.HasPrefix(first, []byte("PK\x03\x04")) && !bytes.HasPrefix(first, []byte("PK\x05\x06")) {
+		return false
+	}
+
+	last := make([]byte, aes.BlockSize)
+	cipher.NewCBCDecrypter(block, tail[len(tail)-2*aes.BlockSize:len(tail)-aes.BlockSize]).CryptBlocks(last, tail[len(tail)-aes.BlockSize:])
+
+	padding := int(last[aes.BlockSize-1])
+
+	return padding > 0 && padding <= aes.BlockSize && bytes.Equal(last[aes.BlockSize-padding:], bytes.Repeat([]byte{byte(padding)}, padding))
+}
@@ -0,0 +1,241 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	openssl "github.com/Luzifer/go-openssl/v4"
+)
+
+// opensslFixture was created with `printf 'parachute openssl fixture\n' | openssl enc -aes-256-cbc -pbkdf2 -pass pass:s3cr3t`
+const opensslFixture = "U2FsdGVkX1/0XE21c+Wx4flvFPCVUAXzHWuUgiQt1+Wg+ukieveMweSgmVMKSUlc"
+
+func encrypt(t *testing.T, plain []byte, passphrase string) []byte {
+	t.Helper()
+
+	var encrypted bytes.Buffer
+
+	w, err := NewEncryptWriter(&encrypted, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// odd write sizes cover data which is buffered across block boundaries
+	for len(plain) > 0 {
+		n := 7
+		if n > len(plain) {
+			n = len(plain)
+		}
+
+		_, err = w.Write(plain[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		plain = plain[n:]
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encrypted.Bytes()
+}
+
+func randomBytes(t *testing.T, size int) []byte {
+	t.Helper()
+
+	data := make([]byte, size)
+
+	_, err := io.ReadFull(rand.Reader, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestCryptRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 1000, 64*1024 + 3} {
+		plain := randomBytes(t, size)
+		encrypted := encrypt(t, plain, "s3cr3t")
+
+		if len(encrypted)%16 != 0 || len(encrypted) <= size {
+			t.Errorf("size %d: unexpected encrypted length %d", size, len(encrypted))
+		}
+
+		r, err := NewDecryptReader(iotest.HalfReader(bytes.NewReader(encrypted)), "s3cr3t")
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+
+		decrypted, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+
+		if !bytes.Equal(decrypted, plain) {
+			t.Errorf("size %d: decrypted data differs", size)
+		}
+	}
+}
+
+func TestCryptSingleBlock(t *testing.T) {
+	plain := bytes.Repeat([]byte{'a'}, 16)
+	encrypted := encrypt(t, plain, "s3cr3t")
+
+	// header and salt, the data block and a full padding block
+	if len(encrypted) != 16+32 {
+		t.Fatalf("expected 48 bytes, got %d", len(encrypted))
+	}
+
+	decrypted, err := DecryptBytes(encrypted, "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decrypted, plain) {
+		t.Errorf("expected %q, got %q", plain, decrypted)
+	}
+}
+
+func TestCryptOpenSSLCompatibility(t *testing.T) {
+	fixture, err := base64.StdEncoding.DecodeString(opensslFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := DecryptBytes(fixture, "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(decrypted) != "parachute openssl fixture\n" {
+		t.Errorf("unexpected plain text %q", decrypted)
+	}
+
+	o := openssl.New()
+
+	for _, size := range []int{0, 16, 1000} {
+		plain := randomBytes(t, size)
+
+		// data of the library decrypts with the new code and the other way around
+		encrypted, err := o.EncryptBinaryBytes("s3cr3t", plain, openssl.PBKDF2SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decrypted, err := DecryptBytes(encrypted, "s3cr3t")
+		if err != nil || !bytes.Equal(decrypted, plain) {
+			t.Errorf("size %d: unable to decrypt the data of go-openssl: %v", size, err)
+		}
+
+		decrypted, err = o.DecryptBinaryBytes("s3cr3t", encrypt(t, plain, "s3cr3t"), openssl.PBKDF2SHA256)
+		if err != nil || !bytes.Equal(decrypted, plain) {
+			t.Errorf("size %d: go-openssl is unable to decrypt the data: %v", size, err)
+		}
+	}
+}
+
+func TestCryptWrongPassphrase(t *testing.T) {
+	encrypted := encrypt(t, randomBytes(t, 1000), "s3cr3t")
+
+	failed := 0
+
+	// an invalid padding is the only hint, 1/256 of the wrong passphrases still end with a valid looking padding
+	for _, passphrase := range []string{"wrong", "S3cr3t", "s3cr3t ", ""} {
+		_, err := DecryptBytes(encrypted, passphrase)
+		if err != nil {
+			failed++
+		}
+	}
+
+	if failed < 3 {
+		t.Errorf("expected wrong passphrases to fail, only %d of 4 failed", failed)
+	}
+}
+
+func TestCryptTruncated(t *testing.T) {
+	// no block of the plain text ends like a valid padding
+	encrypted := encrypt(t, bytes.Repeat([]byte("parachute"), 12), "s3cr3t")
+
+	for _, length := range []int{0, 4, 8, 16, 20, 31, len(encrypted) - 1, len(encrypted) - 16} {
+		_, err := DecryptBytes(encrypted[:length], "s3cr3t")
+		if err == nil {
+			t.Errorf("expected truncated data of %d bytes to fail", length)
+		}
+	}
+}
+
+func TestCryptKDFs(t *testing.T) {
+	defer SetKDF(KDF{Name: KDF_OPENSSL})
+
+	for _, spec := range []string{"openssl", "pbkdf2:iterations=1000", "scrypt:n=1024", "argon2id:time=1,memory=1024,threads=1"} {
+		kdf, err := ParseKDF(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		SetKDF(kdf)
+
+		plain := randomBytes(t, 100)
+		encrypted := encrypt(t, plain, "s3cr3t")
+
+		format := DetectFormat(encrypted)
+		if (kdf.Name == KDF_OPENSSL) != (format == FORMAT_ENCRYPTED) || !format.IsEncrypted() {
+			t.Errorf("%s: unexpected format %s", spec, format)
+		}
+
+		decrypted, err := DecryptBytes(encrypted, "s3cr3t")
+		if err != nil || !bytes.Equal(decrypted, plain) {
+			t.Errorf("%s: round trip failed: %v", spec, err)
+		}
+
+		_, err = DecryptBytes(encrypted[:len(encrypted)-1], "s3cr3t")
+		if err == nil {
+			t.Errorf("%s: expected truncated data to fail", spec)
+		}
+	}
+}
+
+func TestCryptFiles(t *testing.T) {
+	dir := t.TempDir()
+	plain := randomBytes(t, 5000)
+
+	err := os.WriteFile(filepath.Join(dir, "plain"), plain, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = EncryptFile(filepath.Join(dir, "plain"), filepath.Join(dir, "encrypted"), "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = DecryptFile(filepath.Join(dir, "encrypted"), filepath.Join(dir, "decrypted"), "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := os.ReadFile(filepath.Join(dir, "decrypted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decrypted, plain) {
+		t.Error("decrypted file differs")
+	}
+
+	err = DecryptFile(filepath.Join(dir, "plain"), filepath.Join(dir, "failed"), "s3cr3t")
+	if err == nil || !strings.Contains(err.Error(), "salt header missing") {
+		t.Errorf("expected plain data to fail, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Format of archive data, detected from its content instead of its name
+type Format string
+
+const FORMAT_UNKNOWN Format = "unknown"
+
+// FORMAT_ENCRYPTED is encrypted in the OpenSSL compatible format, FORMAT_ENCRYPTED_KDF with a KDF_HEADER
+const FORMAT_ENCRYPTED Format = "encrypted"
+const FORMAT_ENCRYPTED_KDF Format = "encrypted (kdf header)"
+
+const FORMAT_ZIP Format = "zip"
+const FORMAT_TAR Format = "tar"
+const FORMAT_GZIP Format = "gzip"
+const FORMAT_ZSTD Format = "zstd"
+
+// DETECT_SIZE bytes are enough to detect every format, the tar magic is at offset 257
+const DETECT_SIZE = 512
+
+// ErrMissingKey is returned for encrypted data, when neither a passphrase nor a key was supplied
+var ErrMissingKey = errors.New("data is encrypted, but no passphrase or key was supplied (--pass, or --key with --identity)")
+
+// IsEncrypted is true for both encrypted formats
+func (f Format) IsEncrypted() bool {
+	return f == FORMAT_ENCRYPTED || f == FORMAT_ENCRYPTED_KDF
+}
+
+// DetectFormat detects the format of data by the magic bytes at its start
+func DetectFormat(head []byte) Format {
+	switch {
+	case bytes.HasPrefix(head, []byte(OPENSSL_SALT_HEADER)):
+		return FORMAT_ENCRYPTED
+	case bytes.HasPrefix(head, []byte(KDF_HEADER)):
+		return FORMAT_ENCRYPTED_KDF
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")), bytes.HasPrefix(head, []byte("PK\x07\x08")):
+		return FORMAT_ZIP
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return FORMAT_GZIP
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return FORMAT_ZSTD
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return FORMAT_TAR
+	}
+
+	return FORMAT_UNKNOWN
+}
+
+// DetectFileFormat detects the format of the file by its content
+func DetectFileFormat(filePath string) (Format, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return FORMAT_UNKNOWN, err
+	}
+	defer f.Close()
+
+	head := make([]byte, DETECT_SIZE)
+
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FORMAT_UNKNOWN, err
+	}
+
+	return DetectFormat(head[:n]), nil
+}
+
+// Extractable fails for plain data, which is not a zip archive
+func (f Format) Extractable() error {
+	switch {
+	case f.IsEncrypted(), f == FORMAT_ZIP:
+		return nil
+	case f == FORMAT_UNKNOWN:
+		return errors.New("data is neither encrypted nor a zip archive")
+	}
+
+	return fmt.Errorf("data is a %s stream, only zip archives can be extracted", f)
+}
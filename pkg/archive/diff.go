@@ -0,0 +1,160 @@
+package archive
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const CHANGE_ADDED = "added"
+const CHANGE_REMOVED = "removed"
+const CHANGE_MODIFIED = "modified"
+const CHANGE_MODE = "mode"
+
+// zip stores modification times in DOS format with a resolution of two seconds
+const MTIME_TOLERANCE = 2 * time.Second
+
+// Change describes how a file of the live directory would change, if the archive is restored into it
+type Change struct {
+	Path   string `json:"path"`
+	Kind   string `json:"change"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// DiffZip compares the files of the archive with the live directory. Sizes and modification times
+// are compared by default, compareContent compares the CRC32 of the content instead of mtimes.
+func DiffZip(reader *zip.Reader, liveDir string, compareContent bool) ([]Change, error) {
+	entries := map[string]*zip.File{}
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		entries[filepath.ToSlash(filepath.Clean(f.Name))] = f
+	}
+
+	var changes []Change
+	seen := map[string]bool{}
+
+	// a missing live directory is compared as an empty one
+	_, err := os.Stat(liveDir)
+	if errors.Is(err, os.ErrNotExist) {
+		liveDir = ""
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = walkLiveDir(liveDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(liveDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		entry, ok := entries[rel]
+		if !ok {
+			changes = append(changes, Change{Path: rel, Kind: CHANGE_REMOVED})
+			return nil
+		}
+
+		seen[rel] = true
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		change, err := compareEntry(entry, path, info, compareContent)
+		if err != nil {
+			return err
+		}
+
+		if change != nil {
+			change.Path = rel
+			changes = append(changes, *change)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range entries {
+		if !seen[name] {
+			changes = append(changes, Change{Path: name, Kind: CHANGE_ADDED})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes, nil
+}
+
+func walkLiveDir(liveDir string, fn fs.WalkDirFunc) error {
+	if liveDir == "" {
+		return nil
+	}
+
+	return filepath.WalkDir(liveDir, fn)
+}
+
+func compareEntry(entry *zip.File, path string, info os.FileInfo, compareContent bool) (*Change, error) {
+	if int64(entry.UncompressedSize64) != info.Size() {
+		return &Change{Kind: CHANGE_MODIFIED, Detail: fmt.Sprintf("size %d -> %d", info.Size(), entry.UncompressedSize64)}, nil
+	}
+
+	if compareContent {
+		checksum, err := fileCRC32(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if checksum != entry.CRC32 {
+			return &Change{Kind: CHANGE_MODIFIED, Detail: "content differs"}, nil
+		}
+	} else {
+		delta := entry.Modified.Sub(info.ModTime())
+		if delta > MTIME_TOLERANCE || delta < -MTIME_TOLERANCE {
+			return &Change{Kind: CHANGE_MODIFIED, Detail: fmt.Sprintf("mtime %s -> %s", info.ModTime().Format(time.RFC3339), entry.Modified.Format(time.RFC3339))}, nil
+		}
+	}
+
+	if entry.Mode().Perm() != info.Mode().Perm() {
+		return &Change{Kind: CHANGE_MODE, Detail: fmt.Sprintf("%s -> %s", info.Mode().Perm(), entry.Mode().Perm())}, nil
+	}
+
+	return nil, nil
+}
+
+func fileCRC32(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	hash := crc32.NewIEEE()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return 0, err
+	}
+
+	return hash.Sum32(), nil
+}
@@ -61,10 +61,6 @@ func DestinationPath(destination string, fallbackFilename string, incrementIfExi
 
 }
 
-func IsFileEncrypted(path string) bool {
-	return strings.HasSuffix(path, ENCRYPTED_FILE_SUFFIX)
-}
-
 // Source: https://stackoverflow.com/a/50741908
 func CopyFile(source string, destination string) error {
 	inputFile, err := os.Open(source)
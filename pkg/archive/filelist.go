@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileListSources reads the paths of a file list (or stdin for "-"), separated by newlines or NUL characters.
+// Paths keep their location relative to the base directory as entry name, paths outside of it are
+// stored with their absolute path.
+func FileListSources(listPath string, nulSeparated bool, baseDir string) ([]Source, error) {
+	var r io.Reader
+
+	if listPath == STDIO {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(listPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	separator := byte('\n')
+	if nulSeparated {
+		separator = 0
+	}
+
+	if baseDir == "" {
+		baseDir = "."
+	}
+
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []Source
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString(separator)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(line, string(separator))
+		if !nulSeparated {
+			line = strings.TrimSuffix(line, "\r")
+		}
+
+		if line != "" {
+			sources = append(sources, fileListSource(line, baseDir))
+		}
+
+		if errors.Is(err, io.EOF) {
+			return sources, nil
+		}
+	}
+}
+
+func fileListSource(path string, baseDir string) Source {
+	fullPath := path
+	if !filepath.IsAbs(path) {
+		fullPath = filepath.Join(baseDir, path)
+	}
+
+	fullPath = filepath.Clean(fullPath)
+
+	name, err := filepath.Rel(baseDir, fullPath)
+	if err != nil || name == ".." || strings.HasPrefix(name, "../") {
+		name = strings.TrimPrefix(fullPath, "/")
+	}
+
+	return Source{Path: fullPath, Name: name}
+}
@@ -0,0 +1,270 @@
+package archive
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	openssl "github.com/Luzifer/go-openssl/v4"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KDF_OPENSSL derives the key like `openssl enc -pbkdf2` (PBKDF2-SHA256, 10000 iterations) and keeps the OpenSSL
+// compatible "Salted__" format. All other KDFs store their parameters in a KDF_HEADER in front of the encrypted data.
+const KDF_OPENSSL = "openssl"
+const KDF_PBKDF2 = "pbkdf2"
+const KDF_SCRYPT = "scrypt"
+const KDF_ARGON2ID = "argon2id"
+
+// KDF_HEADER starts archives encrypted with a configured KDF, followed by the length (uint16) of the JSON encoded KDF
+const KDF_HEADER = "PRCHKDF1"
+
+// KDF describes the key derivation of an encrypted archive. The derived 48 bytes are the AES-256 key and the CBC IV.
+type KDF struct {
+	Name string `json:"kdf"`
+	Salt []byte `json:"salt,omitempty"`
+
+	// pbkdf2
+	Iterations int `json:"iterations,omitempty"`
+
+	// scrypt
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+
+	// argon2id, memory in KiB
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+}
+
+var defaultKDF = KDF{Name: KDF_OPENSSL}
+
+// SetKDF configures the KDF of newly encrypted archives, decryption always uses the KDF of the archive
+func SetKDF(kdf KDF) {
+	defaultKDF = kdf
+}
+
+// ParseKDF parses "name[:key=value,...]", e.g. "scrypt", "pbkdf2:iterations=600000" or
+// "argon2id:time=3,memory=65536,threads=4". Omitted parameters get secure defaults.
+func ParseKDF(spec string) (KDF, error) {
+	name, params, _ := strings.Cut(spec, ":")
+
+	var kdf KDF
+
+	switch name {
+	case "", KDF_OPENSSL:
+		kdf = KDF{Name: KDF_OPENSSL}
+	case KDF_PBKDF2:
+		kdf = KDF{Name: KDF_PBKDF2, Iterations: 600000}
+	case KDF_SCRYPT:
+		kdf = KDF{Name: KDF_SCRYPT, N: 1 << 15, R: 8, P: 1}
+	case KDF_ARGON2ID:
+		kdf = KDF{Name: KDF_ARGON2ID, Time: 3, Memory: 64 * 1024, Threads: 4}
+	default:
+		return kdf, fmt.Errorf("unsupported kdf '%s' (openssl, pbkdf2, scrypt, argon2id)", name)
+	}
+
+	if params == "" {
+		return kdf, nil
+	}
+
+	if kdf.Name == KDF_OPENSSL {
+		return kdf, errors.New("the openssl kdf has no parameters, use pbkdf2 for a custom iteration count")
+	}
+
+	for _, param := range strings.Split(params, ",") {
+		key, value, found := strings.Cut(param, "=")
+
+		number, err := strconv.Atoi(value)
+		if !found || err != nil || number <= 0 {
+			return kdf, fmt.Errorf("invalid kdf parameter '%s', expected key=number", param)
+		}
+
+		switch {
+		case kdf.Name == KDF_PBKDF2 && key == "iterations":
+			kdf.Iterations = number
+		case kdf.Name == KDF_SCRYPT && key == "n":
+			kdf.N = number
+		case kdf.Name == KDF_SCRYPT && key == "r":
+			kdf.R = number
+		case kdf.Name == KDF_SCRYPT && key == "p":
+			kdf.P = number
+		case kdf.Name == KDF_ARGON2ID && key == "time":
+			kdf.Time = uint32(number)
+		case kdf.Name == KDF_ARGON2ID && key == "memory":
+			kdf.Memory = uint32(number)
+		case kdf.Name == KDF_ARGON2ID && key == "threads" && number < 256:
+			kdf.Threads = uint8(number)
+		default:
+			return kdf, fmt.Errorf("invalid kdf parameter '%s' for %s", param, kdf.Name)
+		}
+	}
+
+	err := kdf.validateParameters()
+	if err != nil {
+		return kdf, fmt.Errorf("%s (iterations up to %d, scrypt n a power of two up to 2^24, argon2id memory up to 4GiB)", err, MAX_PBKDF2_ITERATIONS)
+	}
+
+	return kdf, nil
+}
+
+// withSalt returns a copy of the KDF with a new random salt (8 bytes for openssl, 16 bytes otherwise)
+func (kdf KDF) withSalt() (KDF, error) {
+	size := 16
+	if kdf.Name == KDF_OPENSSL {
+		size = 8
+	}
+
+	kdf.Salt = make([]byte, size)
+
+	_, err := io.ReadFull(rand.Reader, kdf.Salt)
+
+	return kdf, err
+}
+
+// derive returns the AES-256 key and the IV of the passphrase
+func (kdf KDF) derive(passphrase string) ([]byte, []byte, error) {
+	var derived []byte
+	var err error
+
+	switch kdf.Name {
+	case KDF_OPENSSL:
+		creds, err := openssl.PBKDF2SHA256([]byte(passphrase), kdf.Salt)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return creds.Key, creds.IV, nil
+	case KDF_PBKDF2:
+		derived = pbkdf2.Key([]byte(passphrase), kdf.Salt, kdf.Iterations, 48, sha256.New)
+	case KDF_SCRYPT:
+		derived, err = scrypt.Key([]byte(passphrase), kdf.Salt, kdf.N, kdf.R, kdf.P, 48)
+	case KDF_ARGON2ID:
+		derived = argon2.IDKey([]byte(passphrase), kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, 48)
+	default:
+		return nil, nil, fmt.Errorf("unsupported kdf '%s'", kdf.Name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return derived[:32], derived[32:48], nil
+}
+
+// MAX_PBKDF2_ITERATIONS bounds the derivation time of a stored header, far above the OWASP recommendation of 600000
+const MAX_PBKDF2_ITERATIONS = 10000000
+
+// validate rejects missing or unreasonable parameters of a stored header, which would fail or exhaust the derivation
+func (kdf KDF) validate() error {
+	if len(kdf.Salt) < 8 {
+		return fmt.Errorf("invalid %s salt in the archive header", kdf.Name)
+	}
+
+	err := kdf.validateParameters()
+	if err != nil {
+		return fmt.Errorf("%s in the archive header", err)
+	}
+
+	return nil
+}
+
+// validateParameters rejects parameters which would fail or exhaust the derivation
+func (kdf KDF) validateParameters() error {
+	var valid bool
+
+	switch kdf.Name {
+	case KDF_OPENSSL:
+		return nil
+	case KDF_PBKDF2:
+		valid = kdf.Iterations > 0 && kdf.Iterations <= MAX_PBKDF2_ITERATIONS
+	case KDF_SCRYPT:
+		// scrypt requires N to be a power of two
+		valid = kdf.N > 1 && kdf.N <= 1<<24 && kdf.N&(kdf.N-1) == 0 && kdf.R > 0 && kdf.P > 0 && kdf.R*kdf.P < 1<<30
+	case KDF_ARGON2ID:
+		valid = kdf.Time > 0 && kdf.Memory > 0 && kdf.Memory <= 4*1024*1024 && kdf.Threads > 0
+	default:
+		return fmt.Errorf("unsupported kdf '%s'", kdf.Name)
+	}
+
+	if !valid {
+		return fmt.Errorf("invalid %s parameters", kdf.Name)
+	}
+
+	return nil
+}
+
+// writeHeader writes the "Salted__" or the KDF_HEADER in front of the encrypted data
+func (kdf KDF) writeHeader(w io.Writer) error {
+	if kdf.Name == KDF_OPENSSL {
+		_, err := w.Write(append([]byte(OPENSSL_SALT_HEADER), kdf.Salt...))
+		return err
+	}
+
+	params, err := json.Marshal(kdf)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, len(KDF_HEADER)+2, len(KDF_HEADER)+2+len(params))
+	copy(header, KDF_HEADER)
+	binary.BigEndian.PutUint16(header[len(KDF_HEADER):], uint16(len(params)))
+
+	_, err = w.Write(append(header, params...))
+	return err
+}
+
+// readHeader reads the KDF of the encrypted data
+func readHeader(r io.Reader) (KDF, error) {
+	magic := make([]byte, len(OPENSSL_SALT_HEADER))
+
+	_, err := io.ReadFull(r, magic)
+	if err != nil {
+		return KDF{}, fmt.Errorf("encrypted data is too short: %s", err)
+	}
+
+	switch string(magic) {
+	case OPENSSL_SALT_HEADER:
+		kdf := KDF{Name: KDF_OPENSSL, Salt: make([]byte, 8)}
+
+		_, err = io.ReadFull(r, kdf.Salt)
+		if err != nil {
+			return kdf, fmt.Errorf("encrypted data is too short: %s", err)
+		}
+
+		return kdf, nil
+	case KDF_HEADER:
+		length := make([]byte, 2)
+
+		_, err = io.ReadFull(r, length)
+		if err != nil {
+			return KDF{}, fmt.Errorf("encrypted data is too short: %s", err)
+		}
+
+		params := make([]byte, binary.BigEndian.Uint16(length))
+
+		_, err = io.ReadFull(r, params)
+		if err != nil {
+			return KDF{}, fmt.Errorf("encrypted data is too short: %s", err)
+		}
+
+		var kdf KDF
+
+		err = json.Unmarshal(params, &kdf)
+		if err != nil {
+			return kdf, fmt.Errorf("invalid kdf header: %s", err)
+		}
+
+		return kdf, kdf.validate()
+	}
+
+	return KDF{}, errors.New("data does not appear to be encrypted, salt header missing")
+}
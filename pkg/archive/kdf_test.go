@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseKDF(t *testing.T) {
+	tests := []struct {
+		spec  string
+		valid bool
+	}{
+		{"", true},
+		{"openssl", true},
+		{"openssl:iterations=1000", false},
+		{"pbkdf2", true},
+		{"pbkdf2:iterations=10000000", true},
+		{"pbkdf2:iterations=10000001", false},
+		{"scrypt", true},
+		{"scrypt:n=1024,r=8,p=1", true},
+		{"scrypt:n=1000", false},
+		{"scrypt:n=1", false},
+		{"scrypt:n=33554432", false},
+		{"argon2id:time=1,memory=1024,threads=1", true},
+		{"argon2id:memory=8388608", false},
+		{"argon2id:threads=256", false},
+		{"bcrypt", false},
+		{"pbkdf2:iterations=-1", false},
+		{"pbkdf2:rounds=1000", false},
+	}
+
+	for _, test := range tests {
+		_, err := ParseKDF(test.spec)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %t, got %v", test.spec, test.valid, err)
+		}
+	}
+}
+
+func TestReadHeaderRejectsUnreasonableParameters(t *testing.T) {
+	salt := bytes.Repeat([]byte{1}, 16)
+
+	for _, kdf := range []KDF{
+		{Name: KDF_PBKDF2, Salt: salt, Iterations: 1 << 30},
+		{Name: KDF_SCRYPT, Salt: salt, N: 1000, R: 8, P: 1},
+		{Name: KDF_ARGON2ID, Salt: salt, Time: 1, Memory: 1 << 30, Threads: 1},
+		{Name: KDF_PBKDF2, Salt: salt[:4], Iterations: 1000},
+		{Name: "bcrypt", Salt: salt},
+	} {
+		var header bytes.Buffer
+
+		err := kdf.writeHeader(&header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = readHeader(&header)
+		if err == nil {
+			t.Errorf("expected the header %+v to be rejected", kdf)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExtractOptions rewrite the paths of archive entries on extraction
+type ExtractOptions struct {
+	// StripComponents removes the given amount of leading path components, entries without remaining path are skipped
+	StripComponents int
+
+	// Maps move entries below a prefix to another location, relative locations are placed inside of the target
+	Maps []PathMap
+}
+
+// PathMap moves entries below From to To, declared as "from=to"
+type PathMap struct {
+	From string
+	To   string
+}
+
+// ParsePathMaps parses "from=to" mappings, the longest prefix takes precedence
+func ParsePathMaps(args []string) ([]PathMap, error) {
+	var maps []PathMap
+
+	for _, arg := range args {
+		from, to, found := strings.Cut(arg, "=")
+		if !found || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid map '%s', expected from=to", arg)
+		}
+
+		from = path.Clean(strings.Trim(filepath.ToSlash(from), "/"))
+		if from == "." || from == ".." || strings.HasPrefix(from, "../") {
+			return nil, fmt.Errorf("invalid map '%s', must start with a path inside of the archive", arg)
+		}
+
+		maps = append(maps, PathMap{From: from, To: to})
+	}
+
+	sort.SliceStable(maps, func(i, j int) bool {
+		return len(maps[i].From) > len(maps[j].From)
+	})
+
+	return maps, nil
+}
+
+// rewrite returns the extraction path of the entry and the root it has to stay inside of.
+// An empty path skips the entry.
+func (o ExtractOptions) rewrite(name string, target string) (string, string) {
+	name = strings.Trim(filepath.ToSlash(name), "/")
+
+	if o.StripComponents > 0 {
+		components := strings.Split(name, "/")
+		if len(components) <= o.StripComponents {
+			return "", ""
+		}
+
+		name = strings.Join(components[o.StripComponents:], "/")
+	}
+
+	for _, m := range o.Maps {
+		rest, found := strings.CutPrefix(name, m.From)
+		if !found || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			continue
+		}
+
+		if filepath.IsAbs(m.To) {
+			return filepath.Join(m.To, filepath.FromSlash(rest)), m.To
+		}
+
+		name = path.Join(filepath.ToSlash(m.To), rest)
+		break
+	}
+
+	if name == "" || name == "." {
+		return "", ""
+	}
+
+	return filepath.Join(target, filepath.FromSlash(name)), target
+}
+
+// isInside is the ZipSlip (directory traversal) check for rewritten paths
+func isInside(path string, root string, isDir bool) bool {
+	root = filepath.Clean(root)
+
+	if isDir && path == root {
+		return true
+	}
+
+	prefix := root
+	if !strings.HasSuffix(prefix, string(os.PathSeparator)) {
+		prefix += string(os.PathSeparator)
+	}
+
+	return strings.HasPrefix(path, prefix)
+}
@@ -0,0 +1,101 @@
+package archive
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteStaysInside(t *testing.T) {
+	maps, err := ParsePathMaps([]string{"data=restored", "escape=../outside", "abs=/srv/abs", "deep/er=/srv/deeper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		entry   string
+		isDir   bool
+		options ExtractOptions
+		path    string
+		inside  bool
+	}{
+		{"plain entry", "a/b.txt", false, ExtractOptions{}, "/target/a/b.txt", true},
+		{"parent entry", "../evil.txt", false, ExtractOptions{}, "/evil.txt", false},
+		{"nested parent entry", "a/../../evil.txt", false, ExtractOptions{}, "/evil.txt", false},
+		{"absolute entry", "/etc/passwd", false, ExtractOptions{}, "/target/etc/passwd", true},
+		{"parent within the target", "a/../b.txt", false, ExtractOptions{}, "/target/b.txt", true},
+		{"target prefix of a sibling", "../target-evil/x", false, ExtractOptions{}, "/target-evil/x", false},
+		{"target itself as directory", "./", true, ExtractOptions{}, "", false},
+
+		{"strip components", "a/b/c.txt", false, ExtractOptions{StripComponents: 1}, "/target/b/c.txt", true},
+		{"strip all components", "a/b", false, ExtractOptions{StripComponents: 2}, "", false},
+		{"strip beyond the depth", "a/b", false, ExtractOptions{StripComponents: 5}, "", false},
+		{"strip into a parent entry", "a/../../evil.txt", false, ExtractOptions{StripComponents: 1}, "/evil.txt", false},
+
+		{"relative map", "data/x.txt", false, ExtractOptions{Maps: maps}, "/target/restored/x.txt", true},
+		{"map only matches whole components", "database/x.txt", false, ExtractOptions{Maps: maps}, "/target/database/x.txt", true},
+		{"map target outside of the root", "escape/x.txt", false, ExtractOptions{Maps: maps}, "/outside/x.txt", false},
+		{"absolute map", "abs/x.txt", false, ExtractOptions{Maps: maps}, "/srv/abs/x.txt", true},
+		{"absolute map directory", "abs/", true, ExtractOptions{Maps: maps}, "/srv/abs", true},
+		{"absolute map file as root", "abs", false, ExtractOptions{Maps: maps}, "/srv/abs", false},
+		{"absolute map with parent entry", "abs/../../etc/passwd", false, ExtractOptions{Maps: maps}, "/etc/passwd", false},
+		{"longest map first", "deep/er/x.txt", false, ExtractOptions{Maps: maps}, "/srv/deeper/x.txt", true},
+	}
+
+	for _, test := range tests {
+		path, root := test.options.rewrite(test.entry, "/target")
+
+		if path != test.path {
+			t.Errorf("%s: expected path '%s', got '%s'", test.name, test.path, path)
+		}
+
+		if path == "" {
+			continue
+		}
+
+		if inside := isInside(path, root, test.isDir); inside != test.inside {
+			t.Errorf("%s: expected inside %t for '%s' in '%s'", test.name, test.inside, path, root)
+		}
+	}
+}
+
+func TestParsePathMaps(t *testing.T) {
+	for _, arg := range []string{"", "data", "=to", "data=", "..=to", "../data=to", ".=to"} {
+		_, err := ParsePathMaps([]string{arg})
+		if err == nil {
+			t.Errorf("expected map '%s' to be rejected", arg)
+		}
+	}
+}
+
+func TestUnzipRejectsTraversal(t *testing.T) {
+	for _, entry := range []string{"../evil.txt", "a/../../evil.txt"} {
+		dir := t.TempDir()
+		source := filepath.Join(dir, "evil.zip")
+
+		f, err := os.Create(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		writer := zip.NewWriter(f)
+		w, err := writer.Create(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("evil"))
+		writer.Close()
+		f.Close()
+
+		err = UnzipSource(source, filepath.Join(dir, "target"), ExtractOptions{})
+		if err == nil {
+			t.Errorf("%s: expected the extraction to fail", entry)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "evil.txt")); err == nil {
+			t.Errorf("%s: entry was written outside of the target", entry)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const COMMAND_SOURCE_PREFIX = "cmd:"
+
+// Source is a file or directory on disk, or a command/stream whose output is stored as a single archive entry
+type Source struct {
+	// Path is stored below its base name, or below Name when it is set
+	Path string
+
+	// Command is executed with "sh -c", its output is stored as entry Name
+	Command string
+	Name    string
+
+	// Reader is streamed into the entry Name, like stdin
+	Reader io.Reader
+}
+
+// ParseSource turns a command line argument into a source. Arguments like "cmd:pg_dump mydb"
+// are command sources, named after the executed program ("pg_dump.out").
+func ParseSource(arg string) Source {
+	command, isCommand := strings.CutPrefix(arg, COMMAND_SOURCE_PREFIX)
+	if !isCommand {
+		return Source{Path: arg}
+	}
+
+	command = strings.TrimSpace(command)
+
+	name := "command"
+	if fields := strings.Fields(command); len(fields) > 0 {
+		name = filepath.Base(fields[0])
+	}
+
+	return Source{Command: command, Name: fmt.Sprintf("%s.out", name)}
+}
+
+// ParseAliasSource parses "path:alias" mappings, the path is stored as alias inside of the archive
+func ParseAliasSource(arg string) (Source, error) {
+	i := strings.LastIndex(arg, ":")
+	if i <= 0 || i == len(arg)-1 {
+		return Source{}, fmt.Errorf("invalid source '%s', expected path:alias", arg)
+	}
+
+	path, alias := arg[:i], filepath.Clean(arg[i+1:])
+
+	if filepath.IsAbs(alias) || alias == "." || alias == ".." || strings.HasPrefix(alias, "../") {
+		return Source{}, fmt.Errorf("invalid alias '%s', must be a relative path inside of the archive", arg[i+1:])
+	}
+
+	return Source{Path: path, Name: alias}, nil
+}
+
+func ParseAliasSources(args []string) ([]Source, error) {
+	var sources []Source
+
+	for _, arg := range args {
+		source, err := ParseAliasSource(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+func ParseSources(args []string) []Source {
+	sources := make([]Source, len(args))
+	for i, arg := range args {
+		sources[i] = ParseSource(arg)
+	}
+
+	return sources
+}
+
+func (s Source) IsCommand() bool {
+	return s.Command != ""
+}
+
+func (s Source) IsStream() bool {
+	return s.Reader != nil
+}
+
+// baseName is the name of the source within the archive
+func (s Source) baseName() string {
+	if s.IsCommand() || s.IsStream() {
+		return s.Name
+	}
+
+	if s.Name != "" {
+		return filepath.Base(s.Name)
+	}
+
+	return filepath.Base(s.Path)
+}
+
+// entryName is the name of a file/directory within the archive, the path is located inside of the source
+func (s Source) entryName(path string) (string, error) {
+	if s.Name == "" {
+		return filepath.Rel(filepath.Dir(s.Path), path)
+	}
+
+	rel, err := filepath.Rel(s.Path, path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.Name, rel), nil
+}
+
+func (s Source) String() string {
+	if s.IsCommand() {
+		return COMMAND_SOURCE_PREFIX + s.Command
+	}
+
+	if s.IsStream() {
+		return fmt.Sprintf("stream:%s", s.Name)
+	}
+
+	return s.Path
+}
+
+// addCommandToZip streams the stdout of the command into a new entry, a non-zero exit code fails the archive
+func addCommandToZip(ctx context.Context, writer *zip.Writer, source Source) error {
+	headerWriter, err := createStreamEntry(writer, source.Name)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", source.Command)
+	cmd.Stdout = headerWriter
+	cmd.Stderr = &stderr
+
+	log.Debug().Str("command", source.Command).Str("entry", source.Name).Msg("started command source")
+
+	err = cmd.Run()
+
+	if stderr.Len() > 0 {
+		log.Warn().Str("command", source.Command).Str("stderr", strings.TrimSpace(stderr.String())).Msg("command source wrote to stderr")
+	}
+
+	if err != nil {
+		return fmt.Errorf("command source '%s' failed: %s", source.Command, err)
+	}
+
+	log.Debug().Str("command", source.Command).Str("entry", source.Name).Msg("finished command source")
+
+	return nil
+}
+
+// addStreamToZip copies the reader of the source into a new entry
+func addStreamToZip(writer *zip.Writer, source Source) error {
+	headerWriter, err := createStreamEntry(writer, source.Name)
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(headerWriter, source.Reader)
+	if err != nil {
+		return fmt.Errorf("stream source '%s' failed: %s", source.Name, err)
+	}
+
+	log.Debug().Str("entry", source.Name).Int64("bytes", written).Msg("finished stream source")
+
+	return nil
+}
+
+func createStreamEntry(writer *zip.Writer, name string) (io.Writer, error) {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	}
+	header.SetMode(0644)
+
+	return writer.CreateHeader(header)
+}
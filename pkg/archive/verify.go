@@ -0,0 +1,54 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+)
+
+type VerifyReport struct {
+	Entries int
+	Bytes   int64
+	Errors  []string
+}
+
+func (r *VerifyReport) Ok() bool {
+	return len(r.Errors) == 0
+}
+
+// VerifyArchive reads every entry of the archive, which validates its CRC, without extracting any files
+func VerifyArchive(source string, encrypted bool, passphrase string) (*VerifyReport, error) {
+	reader, err := OpenZip(source, encrypted, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	report := &VerifyReport{}
+
+	for _, f := range reader.File {
+		report.Entries++
+
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		written, err := verifyEntry(f.Open)
+		report.Bytes += written
+
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", f.Name, err))
+		}
+	}
+
+	return report, nil
+}
+
+func verifyEntry(open func() (io.ReadCloser, error)) (int64, error) {
+	rc, err := open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	return io.Copy(io.Discard, rc)
+}
@@ -0,0 +1,51 @@
+package archive
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyEncryptedArchive(t *testing.T) {
+	dir := t.TempDir()
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	plain := filepath.Join(dir, "backup.zip")
+
+	f, err := os.Create(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := zip.NewWriter(f)
+	for _, name := range []string{"a.txt", "b/c.txt"} {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("content of " + name))
+	}
+	writer.Close()
+	f.Close()
+
+	err = EncryptFile(plain, plain+".enc", "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyArchive(plain+".enc", true, "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.Ok() || report.Entries != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	temps, err := os.ReadDir(tmp)
+	if err != nil || len(temps) != 0 {
+		t.Errorf("expected the decrypted copy to be removed, found %v (%v)", temps, err)
+	}
+}
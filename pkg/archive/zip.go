@@ -2,6 +2,7 @@ package archive
 
 import (
 	"archive/zip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,7 +11,33 @@ import (
 	"strings"
 )
 
-func ZipSource(source []string, target string) error {
+// ZipOptions control which files end up in an archive and how they are named
+type ZipOptions struct {
+	// Excludes are glob patterns, matched against the base name and the entry name of every file/directory
+	Excludes []string
+
+	// PreservePaths stores sources without alias under their absolute path, instead of their base name
+	PreservePaths bool
+
+	// Name of the archive file, defaults to the base name of a single source or "package"
+	Name string
+}
+
+func (o ZipOptions) isExcluded(name string) bool {
+	for _, pattern := range o.Excludes {
+		if matched, _ := filepath.Match(pattern, filepath.Base(name)); matched {
+			return true
+		}
+
+		if matched, _ := filepath.Match(pattern, filepath.ToSlash(name)); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ZipSource(ctx context.Context, source []Source, target string, options ZipOptions) error {
 	// 1. Create a ZIP file and zip.Writer
 	f, err := os.Create(target)
 	if err != nil {
@@ -18,25 +45,116 @@ func ZipSource(source []string, target string) error {
 	}
 	defer f.Close()
 
-	writer := zip.NewWriter(f)
-	defer writer.Close()
+	err = ZipSourceTo(ctx, source, f, options)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// ZipSourceTo writes a zip archive of all sources into the writer, the context stops running command sources
+func ZipSourceTo(ctx context.Context, source []Source, w io.Writer, options ZipOptions) error {
+	writer := zip.NewWriter(w)
+
+	// file lists may contain directories and their files, every path is added only once.
+	// Different paths with the same entry name would be mixed on extraction and fail the archive.
+	written := map[string]string{}
 
 	for i := range source {
-		currentSourcePath := source[i]
+		if source[i].IsCommand() || source[i].IsStream() {
+			err := checkCollision(written, source[i].Name, source[i].String())
+			if err != nil {
+				writer.Close()
+				return err
+			}
+		}
+
+		if source[i].IsCommand() {
+			err := addCommandToZip(ctx, writer, source[i])
+			if err != nil {
+				writer.Close()
+				return err
+			}
+			continue
+		}
+
+		if source[i].IsStream() {
+			err := addStreamToZip(writer, source[i])
+			if err != nil {
+				writer.Close()
+				return err
+			}
+			continue
+		}
+
+		currentSource := source[i]
+
+		if options.PreservePaths && currentSource.Name == "" {
+			absPath, err := filepath.Abs(currentSource.Path)
+			if err != nil {
+				writer.Close()
+				return err
+			}
+
+			currentSource.Name = strings.TrimPrefix(absPath, "/")
+		}
+
+		err := filepath.Walk(currentSource.Path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			name, err := currentSource.entryName(path)
+			if err != nil {
+				return err
+			}
+
+			if options.isExcluded(name) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 
-		err := filepath.Walk(source[i], func(path string, info os.FileInfo, err error) error {
-			return addPathToZip(writer, currentSourcePath, path)
+			if name == "." || written[name] == path {
+				return nil
+			}
+
+			err = checkCollision(written, name, path)
+			if err != nil {
+				return err
+			}
+
+			return addPathToZip(writer, name, path)
 		})
 
 		if err != nil {
+			writer.Close()
 			return err
 		}
 	}
 
+	return writer.Close()
+}
+
+func checkCollision(written map[string]string, name string, path string) error {
+	if existing, ok := written[name]; ok {
+		// commands are named after their program, only command_sources of a job carry an explicit name
+		hint := "use an alias (--source path:alias)"
+		if strings.HasPrefix(path, COMMAND_SOURCE_PREFIX) || strings.HasPrefix(existing, COMMAND_SOURCE_PREFIX) {
+			hint = "declare the commands as command_sources of a job with an explicit name"
+		}
+
+		return fmt.Errorf("archive entry '%s' of '%s' collides with '%s', %s", name, path, existing, hint)
+	}
+
+	written[name] = path
+
 	return nil
 }
 
-func addPathToZip(writer *zip.Writer, basepath string, path string) error {
+func addPathToZip(writer *zip.Writer, name string, path string) error {
 	info, err := os.Stat(path)
 	if err != nil {
 		return err
@@ -49,10 +167,7 @@ func addPathToZip(writer *zip.Writer, basepath string, path string) error {
 
 	header.Method = zip.Deflate
 
-	header.Name, err = filepath.Rel(filepath.Dir(basepath), path)
-	if err != nil {
-		return err
-	}
+	header.Name = filepath.ToSlash(name)
 	if info.IsDir() {
 		header.Name += "/"
 	}
@@ -77,8 +192,71 @@ func addPathToZip(writer *zip.Writer, basepath string, path string) error {
 	return err
 }
 
+// ZipFile is an opened archive, Close removes the decrypted copy of an encrypted archive
+type ZipFile struct {
+	*zip.ReadCloser
+	decrypted string
+}
+
+func (z *ZipFile) Close() error {
+	err := z.ReadCloser.Close()
+
+	if z.decrypted != "" {
+		removeErr := os.Remove(z.decrypted)
+		if err == nil {
+			err = removeErr
+		}
+	}
+
+	return err
+}
+
+// OpenZip opens the archive, an encrypted archive is decrypted into a temporary file first
+func OpenZip(source string, encrypted bool, passphrase string) (*ZipFile, error) {
+	if !encrypted {
+		r, err := zip.OpenReader(source)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ZipFile{ReadCloser: r}, nil
+	}
+
+	decrypted, err := decryptToTemp(source, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt archive: %s", err)
+	}
+
+	r, err := zip.OpenReader(decrypted)
+	if err != nil {
+		os.Remove(decrypted)
+		return nil, err
+	}
+
+	return &ZipFile{ReadCloser: r, decrypted: decrypted}, nil
+}
+
+func decryptToTemp(source string, passphrase string) (string, error) {
+	f, err := os.CreateTemp("", "parachute-*.zip")
+	if err != nil {
+		return "", err
+	}
+
+	err = f.Close()
+	if err == nil {
+		err = DecryptFile(source, f.Name(), passphrase)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
 // Unzip source: https://stackoverflow.com/a/24792688
-func UnzipSource(source, target string) error {
+func UnzipSource(source, target string, options ExtractOptions) error {
 	r, err := zip.OpenReader(source)
 	if err != nil {
 		return err
@@ -118,10 +296,13 @@ func UnzipSource(source, target string) error {
 			return nil
 		}
 
-		path := filepath.Join(target, f.Name)
+		path, root := options.rewrite(f.Name, target)
+		if path == "" {
+			return nil
+		}
 
 		// Check for ZipSlip (Directory traversal)
-		if !strings.HasPrefix(path, filepath.Clean(target)+string(os.PathSeparator)) {
+		if !isInside(path, root, f.FileInfo().IsDir()) {
 			return fmt.Errorf("illegal file path: %s", path)
 		}
 
@@ -0,0 +1,226 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/scribblerockerz/parachute/pkg/s3"
+)
+
+// ErrNoBackup is returned, when no backup matches the selection
+var ErrNoBackup = errors.New("no backup matches the selection")
+
+var timedNamePattern = regexp.MustCompile(fmt.Sprintf(`^(\d{%d})_(.+)$`, len(archive.TIMED_NAME_FORMAT)))
+
+// Backup is an object below a remote prefix, together with the time its backup was created
+type Backup struct {
+	Key     string
+	Size    int64
+	Created time.Time
+	Job     string
+	Tags    []string
+
+	// loaded is set once the object metadata was read, exact once Created no longer is the modification time
+	loaded bool
+	exact  bool
+}
+
+func (b *Backup) hasTag(tag string) bool {
+	for _, t := range b.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter selects a backup, the latest one which was not created after At (or the latest one at all)
+type Filter struct {
+	At  time.Time
+	Job string
+	Tag string
+
+	// Name limits the selection to backups with this file name, or its timed variants
+	Name string
+}
+
+func (f Filter) matches(b *Backup) bool {
+	if f.Job != "" && b.Job != f.Job {
+		return false
+	}
+
+	if f.Tag != "" && !b.hasTag(f.Tag) {
+		return false
+	}
+
+	return f.matchesTime(b) && f.matchesName(b)
+}
+
+func (f Filter) matchesTime(b *Backup) bool {
+	return f.At.IsZero() || !b.Created.After(f.At)
+}
+
+func (f Filter) matchesName(b *Backup) bool {
+	if f.Name == "" {
+		return true
+	}
+
+	name := path.Base(b.Key)
+	if match := timedNamePattern.FindStringSubmatch(name); match != nil {
+		name = match[2]
+	}
+
+	return name == f.Name
+}
+
+// List returns all backups below the prefix, sorted from newest to oldest. The creation time is read
+// from the object metadata, the timed name or the modification time of the object. The metadata is part of the
+// listing where the storage supports it, otherwise it is read with one request per backup.
+func List(ctx context.Context, client *s3.S3Client, bucket string, prefix string) ([]*Backup, error) {
+	backups, err := list(ctx, client, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range backups {
+		err = b.load(ctx, client, bucket)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sortBackups(backups)
+
+	return backups, nil
+}
+
+// Select returns the latest backup below the prefix which matches the filter. Only the metadata of candidates is
+// read, backups of another name or timed after the selected time are skipped without a request. Candidates are
+// ordered by their created metadata, which copies keep, so a later upload is not necessarily the latest backup.
+func Select(ctx context.Context, client *s3.S3Client, bucket string, prefix string, filter Filter) (*Backup, error) {
+	backups, err := list(ctx, client, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*Backup
+
+	for _, b := range backups {
+		if !filter.matchesName(b) || (b.exact && !filter.matchesTime(b)) {
+			continue
+		}
+
+		err = b.load(ctx, client, bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, b)
+	}
+
+	sortBackups(candidates)
+
+	for _, b := range candidates {
+		if filter.matches(b) {
+			return b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w below 's3://%s/%s'", ErrNoBackup, bucket, prefix)
+}
+
+// list returns the backups below the prefix sorted from newest to oldest, with the metadata of the listing if any
+func list(ctx context.Context, client *s3.S3Client, bucket string, prefix string) ([]*Backup, error) {
+	objects, err := client.ListObjectsWithMetadata(ctx, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []*Backup
+
+	for _, o := range objects {
+		b := &Backup{
+			Key:     o.Key,
+			Size:    o.Size,
+			Created: o.LastModified,
+		}
+
+		if match := timedNamePattern.FindStringSubmatch(path.Base(o.Key)); match != nil {
+			if created, err := time.ParseInLocation(archive.TIMED_NAME_FORMAT, match[1], time.Local); err == nil {
+				b.Created = created
+				b.exact = true
+			}
+		}
+
+		// storages without metadata listings return no user metadata at all, not even the content type
+		if o.UserMetadata != nil {
+			b.apply(o)
+		}
+
+		backups = append(backups, b)
+	}
+
+	sortBackups(backups)
+
+	return backups, nil
+}
+
+// load reads the metadata of the backup, unless the listing already carried it
+func (b *Backup) load(ctx context.Context, client *s3.S3Client, bucket string) error {
+	if b.loaded {
+		return nil
+	}
+
+	info, err := client.StatObject(ctx, bucket, b.Key)
+	if err != nil {
+		return err
+	}
+
+	b.apply(info)
+
+	return nil
+}
+
+func (b *Backup) apply(info minio.ObjectInfo) {
+	b.loaded = true
+	b.Job = s3.Metadata(info, s3.METADATA_JOB)
+
+	if tags := s3.Metadata(info, s3.METADATA_TAGS); tags != "" {
+		b.Tags = strings.Split(tags, ",")
+	}
+
+	if created, err := time.Parse(time.RFC3339, s3.Metadata(info, s3.METADATA_CREATED)); err == nil {
+		b.Created = created
+		b.exact = true
+	}
+}
+
+func sortBackups(backups []*Backup) {
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Created.After(backups[j].Created)
+	})
+}
+
+// ParseTime accepts RFC 3339 and shorter local times like "2006-01-02T15:04" or "2006-01-02"
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time '%s', expected a format like 2006-01-02T15:04", value)
+}
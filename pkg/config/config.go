@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/rs/zerolog"
+	"github.com/scribblerockerz/parachute/pkg/s3"
 	"github.com/spf13/viper"
 )
 
@@ -35,12 +38,56 @@ func InitConfig(configFilePath string) error {
 	viper.SetDefault("log_level", zerolog.LevelErrorValue)
 	viper.SetDefault("log_format", "")
 	viper.SetDefault("passphrase", "")
+	viper.SetDefault("kdf", "openssl")
 	viper.SetDefault("no_encryption", false)
 	viper.SetDefault("timed_name", false)
 	viper.SetDefault("endpoint", "")
 	viper.SetDefault("access_key", "")
 	viper.SetDefault("secret_key", "")
 	viper.SetDefault("remote", "")
+	viper.SetDefault("target", "")
+	viper.SetDefault("key", "")
+	viper.SetDefault("identity", "")
+	viper.SetDefault("download_concurrency", s3.DEFAULT_DOWNLOAD_CONCURRENCY)
+	viper.SetDefault("download_part_size", "16mb")
+	viper.SetDefault("verify", false)
+	viper.SetDefault("verify_download", false)
+	viper.SetDefault("checksum_algorithm", "sha256")
+	viper.SetDefault("stdin_name", "")
+	viper.SetDefault("stdout", false)
+	viper.SetDefault("files_from", "")
+	viper.SetDefault("files_from0", "")
+	viper.SetDefault("base_dir", "")
+	viper.SetDefault("preserve_paths", false)
+	viper.SetDefault("strip_components", 0)
+	viper.SetDefault("latest", false)
+	viper.SetDefault("at", "")
+	viper.SetDefault("versions", false)
+	viper.SetDefault("replication", "require_all")
+	viper.SetDefault("parallel_uploads", false)
+	viper.SetDefault("dry_run", false)
+	viper.SetDefault("keep", 0)
+	viper.SetDefault("old_pass", "")
+	viper.SetDefault("new_pass", "")
+	viper.SetDefault("recipient", "")
+	viper.SetDefault("slot_name", "")
+	viper.SetDefault("state_dir", defaultStateDir())
+	viper.SetDefault("catch_up", "once")
+	viper.SetDefault("hook_timeout", "5m")
+	viper.SetDefault("shutdown_timeout", "5m")
+	viper.SetDefault("retry_max_attempts", s3.DEFAULT_RETRY_MAX_ATTEMPTS)
+	viper.SetDefault("retry_initial_backoff", s3.DEFAULT_RETRY_INITIAL_BACKOFF)
+	viper.SetDefault("retry_max_backoff", s3.DEFAULT_RETRY_MAX_BACKOFF)
+	viper.SetDefault("operation_timeout", 0)
 
 	return nil
 }
+
+func defaultStateDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "parachute")
+	}
+
+	return filepath.Join(home, ".local", "state", "parachute")
+}
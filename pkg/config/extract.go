@@ -0,0 +1,26 @@
+package config
+
+import (
+	"errors"
+
+	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/spf13/viper"
+)
+
+// ExtractOptions returns the configured path rewrites (--strip-components, --map) for extraction
+func ExtractOptions() (archive.ExtractOptions, error) {
+	stripComponents := viper.GetInt("strip_components")
+	if stripComponents < 0 {
+		return archive.ExtractOptions{}, errors.New("strip components must not be negative")
+	}
+
+	maps, err := archive.ParsePathMaps(viper.GetStringSlice("map"))
+	if err != nil {
+		return archive.ExtractOptions{}, err
+	}
+
+	return archive.ExtractOptions{
+		StripComponents: stripComponents,
+		Maps:            maps,
+	}, nil
+}
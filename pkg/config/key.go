@@ -0,0 +1,197 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/scribblerockerz/parachute/pkg/keyring"
+	"github.com/scribblerockerz/parachute/pkg/s3"
+	"github.com/spf13/viper"
+)
+
+// KeyStore reads and writes the repository key file of a remote
+type KeyStore struct {
+	Remote string
+
+	client *s3.S3Client
+	bucket string
+	object string
+
+	// etag of the loaded key file
+	etag string
+}
+
+// unlockedKey is the archive passphrase of a key file, valid as long as the key file keeps its etag
+type unlockedKey struct {
+	etag       string
+	passphrase string
+}
+
+var unlockedMutex sync.Mutex
+var unlocked = map[string]unlockedKey{}
+
+// NewKeyStore resolves the remote of the key file, the targetName overrides the default target
+func NewKeyStore(remote string, targetName string) (*KeyStore, error) {
+	client, resolved, err := NewS3ClientForRemote(remote, targetName)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, object, err := s3.ParseRemote(resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	if object == "" {
+		return nil, errors.New("key file remote must name an object")
+	}
+
+	return &KeyStore{Remote: resolved, client: client, bucket: bucket, object: object}, nil
+}
+
+// Exists reports whether the key file is already stored
+func (ks *KeyStore) Exists(ctx context.Context) (bool, error) {
+	_, err := ks.client.StatObject(ctx, ks.bucket, ks.object)
+	if err == nil {
+		return true, nil
+	}
+
+	if minio.ToErrorResponse(err).StatusCode == 404 {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// ETag returns the etag of the stored key file
+func (ks *KeyStore) ETag(ctx context.Context) (string, error) {
+	info, err := ks.client.StatObject(ctx, ks.bucket, ks.object)
+	if err != nil {
+		return "", fmt.Errorf("unable to read key file '%s': %s", ks.Remote, err)
+	}
+
+	return info.ETag, nil
+}
+
+// Load reads the key file, a later Save only replaces this version of the key file
+func (ks *KeyStore) Load(ctx context.Context) (*keyring.KeyFile, error) {
+	content, etag, err := ks.client.ReadObjectContent(ctx, ks.bucket, ks.object)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key file '%s': %s", ks.Remote, err)
+	}
+
+	ks.etag = etag
+
+	return keyring.Parse(content)
+}
+
+// Save stores the key file. A loaded key file is written conditionally, concurrent changes fail instead of
+// silently dropping the key slots of another run. A new key file never replaces an existing one.
+func (ks *KeyStore) Save(ctx context.Context, k *keyring.KeyFile) error {
+	content, err := k.Marshal()
+	if err != nil {
+		return err
+	}
+
+	var etag string
+	if ks.etag == "" {
+		etag, err = ks.client.CreateObject(ctx, ks.bucket, ks.object, content, "application/json")
+		if errors.Is(err, s3.ErrPreconditionFailed) {
+			return fmt.Errorf("key file '%s' already exists", ks.Remote)
+		}
+	} else {
+		etag, err = ks.client.WriteObject(ctx, ks.bucket, ks.object, content, "application/json", ks.etag)
+		if errors.Is(err, s3.ErrPreconditionFailed) {
+			return fmt.Errorf("key file '%s' was changed concurrently, retry the command", ks.Remote)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	ks.etag = etag
+
+	return nil
+}
+
+// LoadIdentity reads the private key file of an identity, an empty path is no identity
+func LoadIdentity(path string) (*keyring.Identity, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(os.ExpandEnv(path))
+	if err != nil {
+		return nil, err
+	}
+
+	return keyring.ParseIdentity(string(content))
+}
+
+// ArchivePassphrase returns the passphrase of the archive encryption. Without a key file it is the passphrase itself,
+// with a key file it is the data key of the repository, unlocked by the passphrase or the identity.
+func ArchivePassphrase(passphrase string, keyRemote string, identityPath string, targetName string) (string, error) {
+	if keyRemote == "" {
+		return passphrase, nil
+	}
+
+	unlockedMutex.Lock()
+	defer unlockedMutex.Unlock()
+
+	identity, err := LoadIdentity(identityPath)
+	if err != nil {
+		return "", err
+	}
+
+	if passphrase == "" && identity == nil {
+		return "", errors.New("passphrase or identity is required to unlock the key file")
+	}
+
+	ks, err := NewKeyStore(keyRemote, targetName)
+	if err != nil {
+		return "", err
+	}
+
+	// the unlocked data key is reused until the key file changes, a removed slot no longer unlocks it
+	cacheKey := fmt.Sprintf("%s\x00%s\x00%s\x00%s", keyRemote, targetName, identityPath, passphrase)
+	if cached, ok := unlocked[cacheKey]; ok {
+		etag, err := ks.ETag(context.Background())
+		if err != nil {
+			return "", err
+		}
+
+		if etag == cached.etag {
+			return cached.passphrase, nil
+		}
+
+		delete(unlocked, cacheKey)
+	}
+
+	k, err := ks.Load(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := k.Unlock(passphrase, identity)
+	if err != nil {
+		return "", fmt.Errorf("unable to unlock key file '%s': %s", ks.Remote, err)
+	}
+
+	unlocked[cacheKey] = unlockedKey{etag: ks.etag, passphrase: keyring.Passphrase(dataKey)}
+
+	return unlocked[cacheKey].passphrase, nil
+}
+
+// Passphrase returns the archive passphrase of the configured passphrase, key file and identity
+func Passphrase() (string, error) {
+	return ArchivePassphrase(viper.GetString("passphrase"), viper.GetString("key"), viper.GetString("identity"), viper.GetString("target"))
+}
+
+// HasPassphrase is true, when a passphrase or an identity unlocking the key file is configured
+func HasPassphrase() bool {
+	return viper.GetString("passphrase") != "" || (viper.GetString("key") != "" && viper.GetString("identity") != "")
+}
@@ -1,23 +1,47 @@
 package config
 
 import (
-	"errors"
-
+	"github.com/scribblerockerz/parachute/pkg/s3"
 	"github.com/spf13/viper"
 )
 
 func ValidateS3Configuration() error {
-	if viper.GetString("endpoint") == "" {
-		return errors.New("endpoint must be provided")
+	t, err := GetTarget("")
+	if err != nil {
+		return err
 	}
 
-	if viper.GetString("access_key") == "" {
-		return errors.New("access key must be provided")
+	return t.Validate()
+}
+
+// NewS3Client creates a client for the selected (or default) target with the configured retry policy
+func NewS3Client() (*s3.S3Client, error) {
+	t, err := GetTarget("")
+	if err != nil {
+		return nil, err
 	}
 
-	if viper.GetString("secret_key") == "" {
-		return errors.New("secret key must be provided")
+	return t.NewClient()
+}
+
+func RetryPolicy() s3.RetryPolicy {
+	return s3.RetryPolicy{
+		MaxAttempts:    viper.GetInt("retry_max_attempts"),
+		InitialBackoff: viper.GetDuration("retry_initial_backoff"),
+		MaxBackoff:     viper.GetDuration("retry_max_backoff"),
+		Timeout:        viper.GetDuration("operation_timeout"),
 	}
+}
+
+// NewDownload prepares the download of a remote with the configured download concurrency and part size
+func NewDownload(remote string, filePath string) (*s3.DownloadInfo, error) {
+	downloadInfo, err := s3.NewDownload(remote, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	downloadInfo.Concurrency = viper.GetInt("download_concurrency")
+	downloadInfo.PartSize = int64(viper.GetSizeInBytes("download_part_size"))
 
-	return nil
+	return downloadInfo, nil
 }
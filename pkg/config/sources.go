@@ -0,0 +1,33 @@
+package config
+
+import (
+	"errors"
+
+	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/spf13/viper"
+)
+
+// FileListSources reads the sources of the configured file list (--files-from or --files-from0), if any
+func FileListSources() ([]archive.Source, error) {
+	filesFrom := viper.GetString("files_from")
+	filesFrom0 := viper.GetString("files_from0")
+
+	if filesFrom != "" && filesFrom0 != "" {
+		return nil, errors.New("either files-from or files-from0 can be used, not both")
+	}
+
+	if filesFrom != "" {
+		return archive.FileListSources(filesFrom, false, viper.GetString("base_dir"))
+	}
+
+	if filesFrom0 != "" {
+		return archive.FileListSources(filesFrom0, true, viper.GetString("base_dir"))
+	}
+
+	return nil, nil
+}
+
+// ReadsFileListFromStdin is true, when the configured file list is read from stdin
+func ReadsFileListFromStdin() bool {
+	return viper.GetString("files_from") == archive.STDIO || viper.GetString("files_from0") == archive.STDIO
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/scribblerockerz/parachute/pkg/s3"
+	"github.com/spf13/viper"
+)
+
+// Target is a named storage profile, declared as [targets.<name>] table in parachute.toml.
+// Remotes can address a target with "<name>:path/to/object", relative to its bucket and prefix.
+type Target struct {
+	Name string `mapstructure:"-"`
+
+	Endpoint  string `mapstructure:"endpoint"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	Bucket    string `mapstructure:"bucket"`
+	Prefix    string `mapstructure:"prefix"`
+	Region    string `mapstructure:"region"`
+	Insecure  bool   `mapstructure:"insecure"`
+	PathStyle bool   `mapstructure:"path_style"`
+}
+
+// TargetNames returns the names of all configured targets
+func TargetNames() []string {
+	var names []string
+
+	for name := range viper.GetStringMap("targets") {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func isTargetConfigured(name string) bool {
+	return name != "" && viper.IsSet(fmt.Sprintf("targets.%s", strings.ToLower(name)))
+}
+
+// GetTarget returns the named target. Without a name, the target selected with --target
+// is used, which falls back to the global endpoint and credentials.
+func GetTarget(name string) (*Target, error) {
+	if name == "" {
+		name = viper.GetString("target")
+	}
+
+	if name == "" {
+		return &Target{
+			Endpoint:  viper.GetString("endpoint"),
+			AccessKey: viper.GetString("access_key"),
+			SecretKey: viper.GetString("secret_key"),
+		}, nil
+	}
+
+	if name == "s3" {
+		return nil, errors.New("target name 's3' is reserved for 's3://bucket/object' remotes")
+	}
+
+	if !isTargetConfigured(name) {
+		return nil, fmt.Errorf("target '%s' is not configured", name)
+	}
+
+	t := &Target{}
+
+	err := viper.UnmarshalKey(fmt.Sprintf("targets.%s", strings.ToLower(name)), t)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration of target '%s': %s", name, err)
+	}
+
+	t.Name = name
+
+	return t, nil
+}
+
+func (t *Target) Validate() error {
+	if t.Endpoint == "" {
+		return errors.New("endpoint must be provided")
+	}
+
+	if t.AccessKey == "" {
+		return errors.New("access key must be provided")
+	}
+
+	if t.SecretKey == "" {
+		return errors.New("secret key must be provided")
+	}
+
+	return nil
+}
+
+// NewClient validates the target and creates a client with the configured retry policy
+func (t *Target) NewClient() (*s3.S3Client, error) {
+	err := t.Validate()
+	if err != nil {
+		if t.Name != "" {
+			return nil, fmt.Errorf("target '%s': %s", t.Name, err)
+		}
+		return nil, err
+	}
+
+	client, err := s3.NewClientWithOptions(s3.ClientOptions{
+		Endpoint:  t.Endpoint,
+		AccessKey: t.AccessKey,
+		SecretKey: t.SecretKey,
+		UseSSL:    !t.Insecure,
+		Region:    t.Region,
+		PathStyle: t.PathStyle,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client.SetRetryPolicy(RetryPolicy())
+
+	return client, nil
+}
+
+// remote turns an object path relative to the target into a "s3://bucket/object" remote
+func (t *Target) remote(object string) (string, error) {
+	if t.Bucket == "" {
+		return "", fmt.Errorf("target '%s' has no bucket, remote must be declared in \"s3://bucket/some-path\" format", t.Name)
+	}
+
+	key := path.Join(t.Prefix, object)
+	if strings.HasSuffix(object, "/") {
+		key += "/"
+	}
+
+	return fmt.Sprintf("s3://%s/%s", t.Bucket, strings.TrimLeft(key, "/")), nil
+}
+
+// IsRemote reports whether the source addresses a remote object, instead of a local file
+func IsRemote(source string) bool {
+	if strings.HasPrefix(source, "s3://") {
+		return true
+	}
+
+	name, _, found := strings.Cut(source, ":")
+
+	return found && isTargetConfigured(name)
+}
+
+// ResolveRemote determines the target of the remote and returns it with the remote in "s3://bucket/object" format.
+// Remotes may be "s3://bucket/object", "<target>:object" or an object relative to the default target.
+// The targetName overrides the default target of the configuration.
+func ResolveRemote(remote string, targetName string) (*Target, string, error) {
+	if remote == "" {
+		return nil, "", errors.New("remote must be provided")
+	}
+
+	if strings.HasPrefix(remote, "s3://") {
+		t, err := GetTarget(targetName)
+		return t, remote, err
+	}
+
+	object := remote
+
+	if name, rest, found := strings.Cut(remote, ":"); found && isTargetConfigured(name) {
+		targetName = name
+		object = rest
+	}
+
+	t, err := GetTarget(targetName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if t.Name == "" {
+		return nil, "", errors.New("remote must be declared in \"s3://bucket/some-path\" or \"target:some-path\" format")
+	}
+
+	resolved, err := t.remote(object)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return t, resolved, nil
+}
+
+// NewS3ClientForRemote resolves the remote and creates a client for its target
+func NewS3ClientForRemote(remote string, targetName string) (*s3.S3Client, string, error) {
+	t, resolved, err := ResolveRemote(remote, targetName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client, err := t.NewClient()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client, resolved, nil
+}
@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/job"
+	"github.com/scribblerockerz/parachute/pkg/schedule"
+)
+
+// Run executes the scheduled jobs until the context is cancelled. Runs of the same job never overlap.
+// On shutdown, running jobs get the shutdown timeout to finish, before they are cancelled.
+func Run(ctx context.Context, jobs []*job.Job, shutdownTimeout time.Duration) error {
+	state, err := job.LoadState()
+	if err != nil {
+		return err
+	}
+
+	// Running jobs are not cancelled with the daemon context, but after the shutdown timeout
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	var wg sync.WaitGroup
+
+	for _, j := range jobs {
+		sched, err := j.ParseSchedule()
+		if err != nil {
+			return err
+		}
+
+		if sched == nil {
+			log.Info().Str("job", j.Name).Msg("job has no schedule, skipping")
+			continue
+		}
+
+		var lastRun time.Time
+		if runState, ok := state[j.Name]; ok {
+			lastRun = runState.LastRun
+		}
+
+		wg.Add(1)
+		go func(j *job.Job, sched schedule.Schedule) {
+			defer wg.Done()
+			runSchedule(ctx, jobCtx, j, sched, lastRun)
+		}(j, sched)
+	}
+
+	<-ctx.Done()
+
+	log.Info().Msg("shutting down, waiting for running jobs to finish")
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		log.Warn().Dur("timeout", shutdownTimeout).Msg("shutdown timeout exceeded, cancelling running jobs")
+		cancelJobs()
+		<-done
+	}
+
+	log.Info().Msg("daemon stopped")
+
+	return nil
+}
+
+// runSchedule runs a single job sequentially, which prevents overlapping runs of the same job
+func runSchedule(ctx context.Context, jobCtx context.Context, j *job.Job, sched schedule.Schedule, lastRun time.Time) {
+	next := nextRun(j, sched, lastRun, time.Now())
+
+	for {
+		if next.IsZero() {
+			log.Error().Str("job", j.Name).Msg("schedule has no next run, stopping job")
+			return
+		}
+
+		delay := time.Until(next) + jitter(j.Jitter)
+
+		log.Info().Str("job", j.Name).Time("next", next).Dur("delay", delay).Msg("scheduled next run")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		log.Info().Str("job", j.Name).Msg("started scheduled job")
+
+		result, err := j.RunAndRecord(jobCtx)
+		if err != nil {
+			log.Error().Str("job", j.Name).Err(err).Msg("scheduled job failed")
+		} else {
+			log.Info().Str("job", j.Name).Str("destination", result.Remote).Msg("finished scheduled job")
+		}
+
+		// planned from the previous slot, so neither the duration of the run nor the jitter shifts the schedule
+		next = nextRun(j, sched, next, time.Now())
+	}
+}
+
+// nextRun determines the run following the last run (or planned run), applying the catch up policy to runs missed
+// while the daemon was stopped or the previous run took longer than the interval
+func nextRun(j *job.Job, sched schedule.Schedule, lastRun time.Time, now time.Time) time.Time {
+	if lastRun.IsZero() {
+		return sched.Next(now)
+	}
+
+	next := sched.Next(lastRun)
+	if next.After(now) {
+		return next
+	}
+
+	if j.CatchUp == job.CATCH_UP_ONCE {
+		log.Info().Str("job", j.Name).Time("missed", next).Msg("catching up on missed run")
+		return now
+	}
+
+	log.Info().Str("job", j.Name).Time("missed", next).Msg("skipping missed run")
+
+	return sched.Next(now)
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
@@ -0,0 +1,47 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scribblerockerz/parachute/pkg/job"
+	"github.com/scribblerockerz/parachute/pkg/schedule"
+)
+
+func TestNextRun(t *testing.T) {
+	daily, err := schedule.Parse("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	every, err := schedule.Parse("@every 6h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		sched    schedule.Schedule
+		catchUp  string
+		lastRun  time.Time
+		expected time.Time
+	}{
+		{"first start", daily, job.CATCH_UP_ONCE, time.Time{}, time.Date(2026, 10, 20, 3, 0, 0, 0, time.Local)},
+		{"nothing missed", daily, job.CATCH_UP_ONCE, time.Date(2026, 10, 19, 3, 0, 0, 0, time.Local), time.Date(2026, 10, 20, 3, 0, 0, 0, time.Local)},
+		{"missed run caught up", daily, job.CATCH_UP_ONCE, time.Date(2026, 10, 17, 3, 0, 0, 0, time.Local), now},
+		{"missed run skipped", daily, job.CATCH_UP_NONE, time.Date(2026, 10, 17, 3, 0, 0, 0, time.Local), time.Date(2026, 10, 20, 3, 0, 0, 0, time.Local)},
+		{"interval planned from the last slot", every, job.CATCH_UP_NONE, now.Add(-5 * time.Hour), now.Add(time.Hour)},
+		{"interval overrun caught up", every, job.CATCH_UP_ONCE, now.Add(-7 * time.Hour), now},
+		{"interval overrun skipped", every, job.CATCH_UP_NONE, now.Add(-7 * time.Hour), now.Add(6 * time.Hour)},
+	}
+
+	for _, test := range tests {
+		j := &job.Job{Name: "test", CatchUp: test.catchUp}
+
+		if next := nextRun(j, test.sched, test.lastRun, now); !next.Equal(test.expected) {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, next)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package hook
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const PRE_BACKUP = "pre_backup"
+const POST_BACKUP = "post_backup"
+const ON_FAILURE = "on_failure"
+const PRE_RESTORE = "pre_restore"
+const POST_RESTORE = "post_restore"
+
+const DEFAULT_TIMEOUT = 5 * time.Minute
+
+// WAIT_DELAY bounds the wait for the output of processes which outlive the killed hook
+const WAIT_DELAY = 5 * time.Second
+
+// Hooks are shell commands executed around backups and restores. Every hook receives
+// PARACHUTE_* environment variables describing the run, its output ends up in the log.
+type Hooks struct {
+	PreBackup   string        `mapstructure:"pre_backup"`
+	PostBackup  string        `mapstructure:"post_backup"`
+	OnFailure   string        `mapstructure:"on_failure"`
+	PreRestore  string        `mapstructure:"pre_restore"`
+	PostRestore string        `mapstructure:"post_restore"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+}
+
+func (h *Hooks) command(name string) string {
+	switch name {
+	case PRE_BACKUP:
+		return h.PreBackup
+	case POST_BACKUP:
+		return h.PostBackup
+	case ON_FAILURE:
+		return h.OnFailure
+	case PRE_RESTORE:
+		return h.PreRestore
+	case POST_RESTORE:
+		return h.PostRestore
+	}
+
+	return ""
+}
+
+// Run executes the named hook with the given environment, hooks which are not configured are skipped
+func (h *Hooks) Run(ctx context.Context, name string, env map[string]string) error {
+	if h == nil || h.command(name) == "" {
+		return nil
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_TIMEOUT
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	command := h.command(name)
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PARACHUTE_HOOK=%s", name))
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	// the whole process group is killed on timeout, the output of remaining children is abandoned after the delay
+	killProcessGroup(cmd)
+	cmd.WaitDelay = WAIT_DELAY
+
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	log.Info().Str("hook", name).Str("command", command).Msg("started hook")
+
+	err := cmd.Start()
+	if err != nil {
+		return fmt.Errorf("hook '%s' failed to start: %s", name, err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go logOutput(&wg, stdout, name, false)
+	go logOutput(&wg, stderr, name, true)
+
+	err = cmd.Wait()
+
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	wg.Wait()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("hook '%s' timed out after %s", name, timeout)
+	}
+
+	if err != nil {
+		return fmt.Errorf("hook '%s' failed: %s", name, err)
+	}
+
+	log.Info().Str("hook", name).Msg("finished hook")
+
+	return nil
+}
+
+// RunOnFailure executes the on_failure hook, even when the run was cancelled. Its own failure is only logged.
+func (h *Hooks) RunOnFailure(env map[string]string, runErr error) {
+	failureEnv := map[string]string{}
+	for key, value := range env {
+		failureEnv[key] = value
+	}
+
+	failureEnv["PARACHUTE_STATUS"] = "failed"
+	failureEnv["PARACHUTE_ERROR"] = runErr.Error()
+
+	err := h.Run(context.Background(), ON_FAILURE, failureEnv)
+	if err != nil {
+		log.Error().Err(err).Msg("on_failure hook failed")
+	}
+}
+
+func logOutput(wg *sync.WaitGroup, r io.Reader, name string, isStderr bool) {
+	defer wg.Done()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		if isStderr {
+			log.Warn().Str("hook", name).Str("stream", "stderr").Msg(scanner.Text())
+		} else {
+			log.Info().Str("hook", name).Str("stream", "stdout").Msg(scanner.Text())
+		}
+	}
+
+	// drain overlong lines, so the hook is never blocked on a full pipe
+	io.Copy(io.Discard, r)
+}
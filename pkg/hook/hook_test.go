@@ -0,0 +1,43 @@
+package hook
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTimeoutKillsChildren(t *testing.T) {
+	hooks := &Hooks{PreBackup: "sleep 30 & wait", Timeout: 100 * time.Millisecond}
+
+	started := time.Now()
+	err := hooks.Run(context.Background(), PRE_BACKUP, nil)
+
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected the hook to time out, got %v", err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("expected the hook to return after the timeout, took %s", elapsed)
+	}
+}
+
+func TestRun(t *testing.T) {
+	hooks := &Hooks{PostBackup: `test "$PARACHUTE_HOOK" = post_backup && test "$PARACHUTE_STATUS" = success`}
+
+	err := hooks.Run(context.Background(), POST_BACKUP, map[string]string{"PARACHUTE_STATUS": "success"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = hooks.Run(context.Background(), PRE_BACKUP, nil)
+	if err != nil {
+		t.Errorf("expected a hook which is not configured to be skipped, got %v", err)
+	}
+
+	hooks.PreBackup = "echo output; exit 3"
+	err = hooks.Run(context.Background(), PRE_BACKUP, nil)
+	if err == nil {
+		t.Error("expected the failing hook to fail")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package hook
+
+import (
+	"os/exec"
+)
+
+// killProcessGroup keeps the default cancellation, only the shell itself is killed when the context is done
+func killProcessGroup(cmd *exec.Cmd) {
+}
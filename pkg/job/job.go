@@ -0,0 +1,305 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/scribblerockerz/parachute/pkg/hook"
+	"github.com/scribblerockerz/parachute/pkg/naming"
+	"github.com/scribblerockerz/parachute/pkg/schedule"
+	"github.com/spf13/viper"
+)
+
+const FORMAT_ZIP = "zip"
+
+// CATCH_UP_ONCE runs a job once after startup, when at least one scheduled run was missed
+const CATCH_UP_ONCE = "once"
+const CATCH_UP_NONE = "none"
+
+// REPLICATION_REQUIRE_ALL fails a run unless the backup was uploaded to every remote, REPLICATION_REQUIRE_ANY
+// succeeds when at least one upload succeeded
+const REPLICATION_REQUIRE_ALL = "require_all"
+const REPLICATION_REQUIRE_ANY = "require_any"
+
+// Job is a named backup definition, declared as [jobs.<name>] table in parachute.toml
+type Job struct {
+	Name string `mapstructure:"-"`
+
+	// Sources are paths or "cmd:<command>" sources, CommandSources are commands with an explicit entry name
+	Sources        []string        `mapstructure:"sources"`
+	CommandSources []CommandSource `mapstructure:"command_sources"`
+
+	// Aliases are "path:alias" sources, stored as alias inside of the archive. With PreservePaths,
+	// other sources are stored under their absolute path instead of their base name.
+	Aliases       []string `mapstructure:"aliases"`
+	PreservePaths bool     `mapstructure:"preserve_paths"`
+
+	// ExtraSources can not be configured, they are passed by the command line (stdin, file lists)
+	ExtraSources []archive.Source `mapstructure:"-"`
+
+	Excludes []string `mapstructure:"excludes"`
+
+	// Remote may contain placeholders ({hostname}, {job}, {date:2006-01-02}, ...), a remote ending in "/" gets a timed archive name
+	Remote       string `mapstructure:"remote"`
+	Target       string `mapstructure:"target"`
+	NoEncryption *bool  `mapstructure:"no_encryption"`
+	Passphrase   string `mapstructure:"passphrase"`
+	Format       string `mapstructure:"format"`
+
+	// Key is the remote of a repository key file, its data key (unlocked by Passphrase or Identity) encrypts the archives
+	Key      string `mapstructure:"key"`
+	Identity string `mapstructure:"identity"`
+
+	// Remotes are additional destinations of the same archive, uploaded one after another or in parallel.
+	// The Replication policy decides, whether a single failed upload fails the run.
+	Remotes         []string `mapstructure:"remotes"`
+	Replication     string   `mapstructure:"replication"`
+	ParallelUploads bool     `mapstructure:"parallel_uploads"`
+
+	// TimedName prepends a sortable time to the remote object, Retention keeps the latest N of those objects
+	TimedName bool `mapstructure:"timed_name"`
+	Retention int  `mapstructure:"retention"`
+
+	// NoncurrentRetention keeps the latest N noncurrent versions of the remote object in versioned buckets
+	NoncurrentRetention int `mapstructure:"noncurrent_retention"`
+
+	// Schedule is a cron expression (or Interval a duration) for the daemon, runs are delayed by
+	// a random Jitter and runs missed while the daemon was down are handled by the CatchUp policy
+	Schedule string        `mapstructure:"schedule"`
+	Interval string        `mapstructure:"interval"`
+	Jitter   time.Duration `mapstructure:"jitter"`
+	CatchUp  string        `mapstructure:"catch_up"`
+
+	// Tags are stored with the backup, to select it on restore (restore --tag)
+	Tags []string `mapstructure:"tags"`
+
+	Hooks hook.Hooks `mapstructure:"hooks"`
+
+	Verify            *bool  `mapstructure:"verify"`
+	VerifyDownload    *bool  `mapstructure:"verify_download"`
+	ChecksumAlgorithm string `mapstructure:"checksum_algorithm"`
+}
+
+// CommandSource streams the stdout of a command into the archive entry Name, declared as [[jobs.<name>.command_sources]]
+type CommandSource struct {
+	Name    string `mapstructure:"name"`
+	Command string `mapstructure:"command"`
+}
+
+// Names returns the sorted names of all configured jobs
+func Names() []string {
+	var names []string
+
+	for name := range viper.GetStringMap("jobs") {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Load reads the job from the configuration, unset options fall back to their global value
+func Load(name string) (*Job, error) {
+	key := fmt.Sprintf("jobs.%s", name)
+
+	if !viper.IsSet(key) {
+		return nil, fmt.Errorf("job '%s' is not configured", name)
+	}
+
+	j := &Job{}
+
+	err := viper.UnmarshalKey(key, j)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration of job '%s': %s", name, err)
+	}
+
+	j.Name = name
+	j.applyDefaults()
+
+	return j, nil
+}
+
+func LoadAll() ([]*Job, error) {
+	var jobs []*Job
+
+	for _, name := range Names() {
+		j, err := Load(name)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+func (j *Job) applyDefaults() {
+	if j.NoEncryption == nil {
+		noEncryption := viper.GetBool("no_encryption")
+		j.NoEncryption = &noEncryption
+	}
+
+	if j.Passphrase == "" {
+		j.Passphrase = viper.GetString("passphrase")
+	}
+
+	if j.Key == "" {
+		j.Key = viper.GetString("key")
+	}
+
+	if j.Identity == "" {
+		j.Identity = viper.GetString("identity")
+	}
+
+	if j.Format == "" {
+		j.Format = FORMAT_ZIP
+	}
+
+	if j.Verify == nil {
+		verify := viper.GetBool("verify")
+		j.Verify = &verify
+	}
+
+	if j.VerifyDownload == nil {
+		verifyDownload := viper.GetBool("verify_download")
+		j.VerifyDownload = &verifyDownload
+	}
+
+	if j.ChecksumAlgorithm == "" {
+		j.ChecksumAlgorithm = viper.GetString("checksum_algorithm")
+	}
+
+	if j.CatchUp == "" {
+		j.CatchUp = viper.GetString("catch_up")
+	}
+
+	if j.Replication == "" {
+		j.Replication = viper.GetString("replication")
+	}
+
+	if j.Hooks.Timeout == 0 {
+		j.Hooks.Timeout = viper.GetDuration("hook_timeout")
+	}
+}
+
+// AllRemotes returns the remote and all additional remotes of the job
+func (j *Job) AllRemotes() []string {
+	var remotes []string
+
+	if j.Remote != "" {
+		remotes = append(remotes, j.Remote)
+	}
+
+	return append(remotes, j.Remotes...)
+}
+
+func (j *Job) UseEncryption() bool {
+	return j.NoEncryption == nil || !*j.NoEncryption
+}
+
+func (j *Job) Validate() error {
+	if len(j.Sources) == 0 && len(j.CommandSources) == 0 && len(j.Aliases) == 0 && len(j.ExtraSources) == 0 {
+		return errors.New("source archive must be provided")
+	}
+
+	_, err := archive.ParseAliasSources(j.Aliases)
+	if err != nil {
+		return err
+	}
+
+	for _, commandSource := range j.CommandSources {
+		if commandSource.Name == "" || commandSource.Command == "" {
+			return errors.New("command sources require a name and a command")
+		}
+	}
+
+	if j.UseEncryption() && j.Passphrase == "" && (j.Key == "" || j.Identity == "") {
+		return errors.New("provided passphrase is empty")
+	}
+
+	if len(j.AllRemotes()) == 0 {
+		return errors.New("remote destination must be provided")
+	}
+
+	for _, remote := range j.AllRemotes() {
+		_, err = naming.Expand(remote, naming.Vars{Job: j.Name, Time: time.Now()})
+		if err != nil {
+			return err
+		}
+	}
+
+	if j.Replication != "" && j.Replication != REPLICATION_REQUIRE_ALL && j.Replication != REPLICATION_REQUIRE_ANY {
+		return fmt.Errorf("unsupported replication policy '%s' (require_all, require_any)", j.Replication)
+	}
+
+	if j.Format != FORMAT_ZIP {
+		return fmt.Errorf("unsupported archive format '%s' (zip)", j.Format)
+	}
+
+	switch j.ChecksumAlgorithm {
+	case "sha256", "crc32c":
+	default:
+		return fmt.Errorf("unsupported checksum algorithm '%s' (sha256, crc32c)", j.ChecksumAlgorithm)
+	}
+
+	for _, tag := range j.Tags {
+		if tag == "" || strings.Contains(tag, ",") {
+			return fmt.Errorf("invalid tag '%s', tags must not be empty or contain commas", tag)
+		}
+	}
+
+	if j.Retention < 0 || j.NoncurrentRetention < 0 {
+		return errors.New("retention must not be negative")
+	}
+
+	if j.CatchUp != "" && j.CatchUp != CATCH_UP_ONCE && j.CatchUp != CATCH_UP_NONE {
+		return fmt.Errorf("unsupported catch up policy '%s' (once, none)", j.CatchUp)
+	}
+
+	_, err = j.ParseSchedule()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ArchiveSources returns all sources of the job
+func (j *Job) ArchiveSources() []archive.Source {
+	sources := archive.ParseSources(j.Sources)
+
+	// aliases are validated with the job
+	aliasSources, _ := archive.ParseAliasSources(j.Aliases)
+	sources = append(sources, aliasSources...)
+
+	for _, commandSource := range j.CommandSources {
+		sources = append(sources, archive.Source{Name: commandSource.Name, Command: commandSource.Command})
+	}
+
+	sources = append(sources, j.ExtraSources...)
+
+	return sources
+}
+
+// ParseSchedule returns the schedule of the job, or nil when the job is not scheduled
+func (j *Job) ParseSchedule() (schedule.Schedule, error) {
+	if j.Schedule != "" && j.Interval != "" {
+		return nil, errors.New("either schedule or interval can be configured, not both")
+	}
+
+	if j.Schedule != "" {
+		return schedule.Parse(j.Schedule)
+	}
+
+	if j.Interval != "" {
+		return schedule.ParseInterval(j.Interval)
+	}
+
+	return nil, nil
+}
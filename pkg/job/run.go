@@ -0,0 +1,408 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/hook"
+	"github.com/scribblerockerz/parachute/pkg/naming"
+	"github.com/scribblerockerz/parachute/pkg/s3"
+)
+
+// Result describes the backup which was created by a job run, Remote is the first successful destination
+type Result struct {
+	Remote       string
+	Size         int64
+	SHA256       string
+	Destinations []Destination
+}
+
+// Destination is the outcome of the upload to a single remote
+type Destination struct {
+	Remote string `json:"remote"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Run creates the archive of the job and uploads it to the remote destinations, surrounded by the backup hooks.
+// A failed run may still return a result, which describes the outcome of every destination.
+func (j *Job) Run(ctx context.Context) (*Result, error) {
+	err := j.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{
+		"PARACHUTE_JOB":     j.Name,
+		"PARACHUTE_REMOTE":  j.AllRemotes()[0],
+		"PARACHUTE_REMOTES": strings.Join(j.AllRemotes(), " "),
+	}
+
+	err = j.Hooks.Run(ctx, hook.PRE_BACKUP, env)
+	if err != nil {
+		j.Hooks.RunOnFailure(env, err)
+		return nil, err
+	}
+
+	result, err := j.backup(ctx)
+	if err != nil {
+		j.Hooks.RunOnFailure(env, err)
+		return result, err
+	}
+
+	var uploaded []string
+	for _, d := range result.Destinations {
+		if d.Status == STATUS_SUCCESS {
+			uploaded = append(uploaded, d.Remote)
+		}
+	}
+
+	env["PARACHUTE_STATUS"] = STATUS_SUCCESS
+	env["PARACHUTE_REMOTE"] = result.Remote
+	env["PARACHUTE_REMOTES"] = strings.Join(uploaded, " ")
+	env["PARACHUTE_ARCHIVE_SIZE"] = strconv.FormatInt(result.Size, 10)
+	env["PARACHUTE_ARCHIVE_SHA256"] = result.SHA256
+
+	err = j.Hooks.Run(ctx, hook.POST_BACKUP, env)
+	if err != nil {
+		j.Hooks.RunOnFailure(env, err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// backup creates the archive once and uploads it to every remote of the job. Whether partial uploads
+// fail the run depends on the replication policy, the result holds the outcome of every destination.
+func (j *Job) backup(ctx context.Context) (*Result, error) {
+	now := time.Now()
+
+	passphrase := ""
+	if j.UseEncryption() {
+		var err error
+		passphrase, err = config.ArchivePassphrase(j.Passphrase, j.Key, j.Identity, j.Target)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a, err := archive.CreateArchiveFromSources(
+		ctx,
+		j.ArchiveSources(),
+		j.UseEncryption(),
+		passphrase,
+		archive.ZipOptions{Excludes: j.Excludes, PreservePaths: j.PreservePaths, Name: j.Name},
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer a.RemoveTempLocation()
+
+	remotes := j.AllRemotes()
+	destinations := make([]Destination, len(remotes))
+
+	if j.ParallelUploads {
+		var wg sync.WaitGroup
+
+		for i, remote := range remotes {
+			wg.Add(1)
+			go func(i int, remote string) {
+				defer wg.Done()
+				destinations[i] = j.uploadTo(ctx, a, remote, now)
+			}(i, remote)
+		}
+
+		wg.Wait()
+	} else {
+		for i, remote := range remotes {
+			destinations[i] = j.uploadTo(ctx, a, remote, now)
+		}
+	}
+
+	err = a.Cleanup()
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := a.Checksums()
+
+	result := &Result{
+		Size:         checksums.Size,
+		SHA256:       checksums.SHA256Hex(),
+		Destinations: destinations,
+	}
+
+	var failures []string
+
+	for _, d := range destinations {
+		if d.Status != STATUS_SUCCESS {
+			failures = append(failures, fmt.Sprintf("%s: %s", d.Remote, d.Error))
+			continue
+		}
+
+		if result.Remote == "" {
+			result.Remote = d.Remote
+		}
+	}
+
+	if len(failures) == 0 {
+		return result, nil
+	}
+
+	if result.Remote != "" && j.Replication == REPLICATION_REQUIRE_ANY {
+		log.Warn().Str("job", j.Name).Strs("failures", failures).Msg("backup was not uploaded to every destination")
+		return result, nil
+	}
+
+	return result, fmt.Errorf("upload failed for %d of %d destinations (%s)", len(failures), len(destinations), strings.Join(failures, "; "))
+}
+
+// uploadTo uploads the archive to a single remote, including verification and pruning
+func (j *Job) uploadTo(ctx context.Context, a *archive.Archive, remoteTemplate string, now time.Time) Destination {
+	remote, err := j.upload(ctx, a, remoteTemplate, now)
+	if err != nil {
+		log.Error().Str("job", j.Name).Str("destination", remote).Err(err).Msg("upload to destination failed")
+		return Destination{Remote: remote, Status: STATUS_FAILED, Error: err.Error()}
+	}
+
+	return Destination{Remote: remote, Status: STATUS_SUCCESS}
+}
+
+// upload returns the remote the archive was uploaded to, or the remote template when it could not be resolved
+func (j *Job) upload(ctx context.Context, a *archive.Archive, remoteTemplate string, now time.Time) (string, error) {
+	expandedRemote, err := naming.Expand(remoteTemplate, naming.Vars{Job: j.Name, Time: now})
+	if err != nil {
+		return remoteTemplate, err
+	}
+
+	client, resolvedRemote, err := config.NewS3ClientForRemote(expandedRemote, j.Target)
+	if err != nil {
+		return remoteTemplate, err
+	}
+
+	// a remote prefix gets the timed name of the archive, so every backup is kept
+	timed := j.TimedName
+	if strings.HasSuffix(resolvedRemote, "/") {
+		resolvedRemote += path.Base(a.TempDestination())
+		timed = true
+	}
+
+	remote := resolvedRemote
+	if timed {
+		remote = timedRemote(remote, now)
+	}
+
+	payload, err := s3.NewPayload(remote, a.TempDestination())
+	if err != nil {
+		return remote, err
+	}
+
+	checksums := a.Checksums()
+	payload.UserMetadata = map[string]string{
+		s3.METADATA_SHA256:  checksums.SHA256Hex(),
+		s3.METADATA_CREATED: now.UTC().Format(time.RFC3339),
+	}
+
+	if j.Name != "" {
+		payload.UserMetadata[s3.METADATA_JOB] = j.Name
+	}
+
+	if len(j.Tags) > 0 {
+		payload.UserMetadata[s3.METADATA_TAGS] = strings.Join(j.Tags, ",")
+	}
+
+	verify := *j.Verify || *j.VerifyDownload
+	if verify {
+		if j.ChecksumAlgorithm == "crc32c" {
+			payload.ChecksumCRC32C = checksums.CRC32CBase64()
+		} else {
+			payload.ChecksumSHA256 = checksums.SHA256Base64()
+		}
+	}
+
+	log.Debug().Str("bucket", payload.Bucket).Str("object", payload.Object).Msg("started uploading")
+
+	_, err = client.UploadPayload(ctx, payload)
+	if err != nil {
+		return remote, err
+	}
+
+	log.Debug().Str("bucket", payload.Bucket).Str("object", payload.Object).Msg("finished uploading")
+
+	if verify {
+		err = client.VerifyObject(ctx, payload.Bucket, payload.Object, s3.Verification{
+			Size:     checksums.Size,
+			SHA256:   checksums.SHA256,
+			CRC32C:   payload.ChecksumCRC32C,
+			Download: *j.VerifyDownload,
+		})
+		if err != nil {
+			return remote, fmt.Errorf("verification of uploaded backup failed: %s", err)
+		}
+
+		log.Info().Str("destination", remote).Str("sha256", checksums.SHA256Hex()).Msg("verified uploaded backup")
+	}
+
+	if j.Retention > 0 && !timed {
+		log.Warn().Str("job", j.Name).Msg("retention requires timed names, skipping pruning")
+	} else if j.Retention > 0 {
+		err = j.prune(ctx, client, remoteTemplate, path.Base(resolvedRemote), now)
+		if err != nil {
+			return remote, err
+		}
+	}
+
+	if j.NoncurrentRetention > 0 {
+		err = j.pruneVersions(ctx, client, payload.Bucket, payload.Object)
+		if err != nil {
+			return remote, err
+		}
+	}
+
+	return remote, nil
+}
+
+// timedRemote prepends a sortable time in front of the remote object name
+func timedRemote(remote string, t time.Time) string {
+	dir, fileName := path.Split(remote)
+	return dir + archive.TimedName(fileName, t)
+}
+
+// prune removes all but the latest timed backups of the job. Placeholders of the time may expand to another directory
+// on every run, so all backups below the prefix in front of the first of them are considered. {hostname} and {job}
+// are expanded beforehand, the backups of other hosts and jobs are never counted.
+func (j *Job) prune(ctx context.Context, client *s3.S3Client, remoteTemplate string, fileName string, now time.Time) error {
+	staticRemote, err := naming.ExpandStatic(remoteTemplate, naming.Vars{Job: j.Name, Time: now})
+	if err != nil {
+		return err
+	}
+
+	_, remote, err := config.ResolveRemote(staticRemote, j.Target)
+	if err != nil {
+		return err
+	}
+
+	bucket, object, err := s3.ParseRemote(remote)
+	if err != nil {
+		return err
+	}
+
+	dir, templateName := path.Split(object)
+	if templateName != "" {
+		fileName = templateName
+	}
+
+	objects, err := client.ListObjects(ctx, bucket, naming.StaticPrefix(dir))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+
+	for _, key := range expiredBackups(keys, dir, fileName, j.Retention) {
+		err = client.RemoveObject(ctx, bucket, key)
+		if err != nil {
+			return err
+		}
+
+		log.Info().Str("job", j.Name).Str("bucket", bucket).Str("object", key).Msg("removed backup exceeding retention")
+	}
+
+	return nil
+}
+
+// expiredBackups returns the keys of timed backups matching the directory and file name templates, which exceed the
+// retention. Backups are ordered by the time of their name, the directory may sort differently.
+func expiredBackups(keys []string, dir string, fileName string, retention int) []string {
+	timedPattern := regexp.MustCompile(fmt.Sprintf(`^%s(\d{%d})_%s$`, naming.Pattern(dir), len(archive.TIMED_NAME_FORMAT), naming.Pattern(fileName)))
+
+	type backup struct {
+		key  string
+		time string
+	}
+
+	var backups []backup
+	for _, key := range keys {
+		match := timedPattern.FindStringSubmatch(key)
+		if match != nil {
+			backups = append(backups, backup{key: key, time: match[1]})
+		}
+	}
+
+	if len(backups) <= retention {
+		return nil
+	}
+
+	// the latest backups are last
+	sort.Slice(backups, func(a, b int) bool {
+		if backups[a].time != backups[b].time {
+			return backups[a].time < backups[b].time
+		}
+		return backups[a].key < backups[b].key
+	})
+
+	expired := make([]string, 0, len(backups)-retention)
+	for _, b := range backups[:len(backups)-retention] {
+		expired = append(expired, b.key)
+	}
+
+	return expired
+}
+
+// pruneVersions removes all but the latest noncurrent versions of the object. Delete markers hold no data and are
+// not counted, noncurrent markers are removed once they are older than the oldest kept version.
+func (j *Job) pruneVersions(ctx context.Context, client *s3.S3Client, bucket string, object string) error {
+	versions, err := client.ListVersions(ctx, bucket, object)
+	if err != nil {
+		return err
+	}
+
+	kept := 0
+
+	for _, v := range versions {
+		if v.IsLatest {
+			continue
+		}
+
+		if v.IsDeleteMarker {
+			if kept < j.NoncurrentRetention {
+				continue
+			}
+
+			err = client.RemoveObjectVersion(ctx, bucket, object, v.VersionID)
+			if err != nil {
+				return err
+			}
+
+			log.Info().Str("job", j.Name).Str("bucket", bucket).Str("object", object).Str("version", v.VersionID).Msg("removed delete marker exceeding retention")
+			continue
+		}
+
+		if kept < j.NoncurrentRetention {
+			kept++
+			continue
+		}
+
+		err = client.RemoveObjectVersion(ctx, bucket, object, v.VersionID)
+		if err != nil {
+			return err
+		}
+
+		log.Info().Str("job", j.Name).Str("bucket", bucket).Str("object", object).Str("version", v.VersionID).Msg("removed version exceeding retention")
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package job
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpiredBackups(t *testing.T) {
+	keys := []string{
+		"alpha/20261017010000_db.zip",
+		"alpha/20261018010000_db.zip",
+		"alpha/20261019010000_db.zip",
+		"alpha/db.zip",
+		"alpha/20261019010000_other.zip",
+		"alpha/nested/20261001010000_db.zip",
+		"zulu/20261016010000_db.zip",
+		"zulu/20261020010000_db.zip",
+	}
+
+	// a remote of "{hostname}/" on the host alpha, the backups of zulu are not counted
+	expired := expiredBackups(keys, "alpha/", "db.zip", 2)
+	if expected := []string{"alpha/20261017010000_db.zip"}; !reflect.DeepEqual(expired, expected) {
+		t.Errorf("expected %v, got %v", expected, expired)
+	}
+
+	expired = expiredBackups(keys, "zulu/", "db.zip", 2)
+	if len(expired) != 0 {
+		t.Errorf("expected no expired backups, got %v", expired)
+	}
+}
+
+func TestExpiredBackupsByTime(t *testing.T) {
+	// the directory of the date sorts differently than the time of the backups
+	keys := []string{
+		"host/19-10-2026/20261019010000_db.zip",
+		"host/20-09-2026/20260920010000_db.zip",
+		"host/01-10-2026/20261001010000_db.zip",
+		"host/02-10-2026/other/20261002010000_db.zip",
+	}
+
+	expired := expiredBackups(keys, "host/{date:02-01-2006}/", "db.zip", 1)
+	if expected := []string{"host/20-09-2026/20260920010000_db.zip", "host/01-10-2026/20261001010000_db.zip"}; !reflect.DeepEqual(expired, expected) {
+		t.Errorf("expected %v, got %v", expected, expired)
+	}
+}
@@ -0,0 +1,124 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const STATUS_SUCCESS = "success"
+const STATUS_FAILED = "failed"
+
+// RunState records the outcome of the last run of a job
+type RunState struct {
+	LastRun  time.Time     `json:"lastRun"`
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Remote   string        `json:"remote,omitempty"`
+	Size     int64         `json:"size,omitempty"`
+	Duration time.Duration `json:"duration"`
+
+	Destinations []Destination `json:"destinations,omitempty"`
+}
+
+var stateMutex sync.Mutex
+
+func stateFile() string {
+	return filepath.Join(os.ExpandEnv(viper.GetString("state_dir")), "jobs.json")
+}
+
+// LoadState reads the run state of all jobs, keyed by job name
+func LoadState() (map[string]*RunState, error) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	return loadState()
+}
+
+func loadState() (map[string]*RunState, error) {
+	state := map[string]*RunState{}
+
+	content, err := os.ReadFile(stateFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// RecordRun persists the outcome of a job run
+func RecordRun(name string, runState *RunState) error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	state, err := loadState()
+	if err != nil {
+		return err
+	}
+
+	state[name] = runState
+
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(stateFile()), 0700)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(stateFile()+".tmp", content, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(stateFile()+".tmp", stateFile())
+}
+
+// RunAndRecord runs the job and records its outcome in the state file
+func (j *Job) RunAndRecord(ctx context.Context) (*Result, error) {
+	started := time.Now()
+
+	result, err := j.Run(ctx)
+
+	runState := &RunState{
+		LastRun:  started,
+		Status:   STATUS_SUCCESS,
+		Duration: time.Since(started),
+	}
+
+	if err != nil {
+		runState.Status = STATUS_FAILED
+		runState.Error = err.Error()
+	} else {
+		runState.Remote = result.Remote
+		runState.Size = result.Size
+	}
+
+	if result != nil {
+		runState.Destinations = result.Destinations
+	}
+
+	recordErr := RecordRun(j.Name, runState)
+	if recordErr != nil {
+		log.Warn().Str("job", j.Name).Err(recordErr).Msg("unable to record job state")
+	}
+
+	return result, err
+}
@@ -0,0 +1,312 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const VERSION = 1
+
+// SLOT_PASSPHRASE slots seal the data key with a key derived from a passphrase (scrypt),
+// SLOT_PUBLIC_KEY slots seal it anonymously for the holder of an X25519 private key (identity)
+const SLOT_PASSPHRASE = "passphrase"
+const SLOT_PUBLIC_KEY = "public_key"
+
+const DATA_KEY_SIZE = 32
+
+// scrypt parameters of new passphrase slots
+const SCRYPT_N = 1 << 15
+const SCRYPT_R = 8
+const SCRYPT_P = 1
+
+// MAX_SCRYPT_MEMORY bounds the memory of the derivation (128 * n * r bytes) of a stored slot
+const MAX_SCRYPT_MEMORY = 1 << 30
+
+// KeyFile is stored next to the backups and holds the random data key of the repository, sealed in one or more slots.
+// Archives are encrypted with the data key, so slots can be added and removed without touching them.
+type KeyFile struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Slots   []*Slot   `json:"slots"`
+}
+
+// Slot holds the sealed data key, only the fields of its type are set
+type Slot struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Name    string    `json:"name,omitempty"`
+	Created time.Time `json:"created"`
+
+	// passphrase slots
+	KDF   *KDF   `json:"kdf,omitempty"`
+	Nonce []byte `json:"nonce,omitempty"`
+
+	// public key slots
+	Recipient []byte `json:"recipient,omitempty"`
+
+	Sealed []byte `json:"sealed"`
+}
+
+// KDF describes the scrypt derivation of the key of a passphrase slot
+type KDF struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// Identity is an X25519 key pair, which unlocks public key slots
+type Identity struct {
+	PublicKey  [32]byte
+	PrivateKey [32]byte
+}
+
+// New creates a key file with a random data key, which has to be sealed in a slot before the key file is stored
+func New() (*KeyFile, []byte, error) {
+	dataKey := make([]byte, DATA_KEY_SIZE)
+
+	_, err := io.ReadFull(rand.Reader, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &KeyFile{Version: VERSION, Created: time.Now().UTC()}, dataKey, nil
+}
+
+// Parse reads a stored key file
+func Parse(content []byte) (*KeyFile, error) {
+	k := &KeyFile{}
+
+	err := json.Unmarshal(content, k)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file: %s", err)
+	}
+
+	if k.Version != VERSION {
+		return nil, fmt.Errorf("unsupported key file version %d", k.Version)
+	}
+
+	return k, nil
+}
+
+// Marshal encodes the key file for storage
+func (k *KeyFile) Marshal() ([]byte, error) {
+	return json.MarshalIndent(k, "", "  ")
+}
+
+// Unlock opens the first slot, which the passphrase or the identity (may be nil) matches, and returns the data key
+func (k *KeyFile) Unlock(passphrase string, identity *Identity) ([]byte, error) {
+	for _, slot := range k.Slots {
+		var dataKey []byte
+		var ok bool
+
+		switch {
+		case slot.Type == SLOT_PASSPHRASE && passphrase != "":
+			dataKey, ok = slot.openPassphrase(passphrase)
+		case slot.Type == SLOT_PUBLIC_KEY && identity != nil && string(slot.Recipient) == string(identity.PublicKey[:]):
+			dataKey, ok = box.OpenAnonymous(nil, slot.Sealed, &identity.PublicKey, &identity.PrivateKey)
+		}
+
+		if ok {
+			return dataKey, nil
+		}
+	}
+
+	return nil, errors.New("no key slot matches the passphrase or identity")
+}
+
+// AddPassphrase seals the data key in a new passphrase slot
+func (k *KeyFile) AddPassphrase(dataKey []byte, passphrase string, name string) (*Slot, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase of the key slot must not be empty")
+	}
+
+	kdf := &KDF{Name: "scrypt", Salt: make([]byte, 16), N: SCRYPT_N, R: SCRYPT_R, P: SCRYPT_P}
+
+	_, err := io.ReadFull(rand.Reader, kdf.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := kdf.derive(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+
+	_, err = io.ReadFull(rand.Reader, nonce[:])
+	if err != nil {
+		return nil, err
+	}
+
+	slot := k.newSlot(SLOT_PASSPHRASE, name)
+	slot.KDF = kdf
+	slot.Nonce = nonce[:]
+	slot.Sealed = secretbox.Seal(nil, dataKey, &nonce, key)
+
+	return slot, nil
+}
+
+// AddPublicKey seals the data key in a new slot for the holder of the private key
+func (k *KeyFile) AddPublicKey(dataKey []byte, recipient [32]byte, name string) (*Slot, error) {
+	sealed, err := box.SealAnonymous(nil, dataKey, &recipient, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	slot := k.newSlot(SLOT_PUBLIC_KEY, name)
+	slot.Recipient = recipient[:]
+	slot.Sealed = sealed
+
+	return slot, nil
+}
+
+// Remove deletes the slot with the id, the last slot can not be removed
+func (k *KeyFile) Remove(id string) error {
+	for i, slot := range k.Slots {
+		if slot.ID != id {
+			continue
+		}
+
+		if len(k.Slots) == 1 {
+			return errors.New("the last key slot can not be removed")
+		}
+
+		k.Slots = append(k.Slots[:i], k.Slots[i+1:]...)
+
+		return nil
+	}
+
+	return fmt.Errorf("key slot '%s' does not exist", id)
+}
+
+func (k *KeyFile) newSlot(slotType string, name string) *Slot {
+	slot := &Slot{
+		ID:      strings.Split(uuid.NewString(), "-")[0],
+		Type:    slotType,
+		Name:    name,
+		Created: time.Now().UTC(),
+	}
+
+	k.Slots = append(k.Slots, slot)
+
+	return slot
+}
+
+func (s *Slot) openPassphrase(passphrase string) ([]byte, bool) {
+	if s.KDF == nil || len(s.Nonce) != 24 {
+		return nil, false
+	}
+
+	key, err := s.KDF.derive(passphrase)
+	if err != nil {
+		return nil, false
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], s.Nonce)
+
+	return secretbox.Open(nil, s.Sealed, &nonce, key)
+}
+
+func (kdf *KDF) derive(passphrase string) (*[32]byte, error) {
+	err := kdf.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	derived, err := scrypt.Key([]byte(passphrase), kdf.Salt, kdf.N, kdf.R, kdf.P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	var key [32]byte
+	copy(key[:], derived)
+
+	return &key, nil
+}
+
+// validate rejects the parameters of a tampered or corrupted key file, which would fail or exhaust the derivation
+func (kdf *KDF) validate() error {
+	if kdf.Name != "scrypt" {
+		return fmt.Errorf("unsupported key derivation '%s'", kdf.Name)
+	}
+
+	// scrypt requires N to be a power of two
+	valid := len(kdf.Salt) >= 8 && kdf.N > 1 && kdf.N&(kdf.N-1) == 0 && kdf.R > 0 && kdf.P > 0 && kdf.P <= 16 &&
+		kdf.N <= MAX_SCRYPT_MEMORY/128/kdf.R
+
+	if !valid {
+		return fmt.Errorf("invalid scrypt parameters (n=%d, r=%d, p=%d)", kdf.N, kdf.R, kdf.P)
+	}
+
+	return nil
+}
+
+// Passphrase encodes the data key as passphrase of the archive encryption
+func Passphrase(dataKey []byte) string {
+	return hex.EncodeToString(dataKey)
+}
+
+// GenerateIdentity creates a new X25519 key pair
+func GenerateIdentity() (*Identity, error) {
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{PublicKey: *publicKey, PrivateKey: *privateKey}, nil
+}
+
+// ParseIdentity reads a base64 encoded private key, as written by EncodeIdentity
+func ParseIdentity(content string) (*Identity, error) {
+	privateKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content))
+	if err != nil || len(privateKey) != 32 {
+		return nil, errors.New("identity must be a base64 encoded 32 byte private key")
+	}
+
+	identity := &Identity{}
+	copy(identity.PrivateKey[:], privateKey)
+	curve25519.ScalarBaseMult(&identity.PublicKey, &identity.PrivateKey)
+
+	return identity, nil
+}
+
+// EncodeIdentity returns the base64 encoded private key
+func EncodeIdentity(identity *Identity) string {
+	return base64.StdEncoding.EncodeToString(identity.PrivateKey[:])
+}
+
+// ParsePublicKey reads a base64 encoded public key
+func ParsePublicKey(content string) ([32]byte, error) {
+	var recipient [32]byte
+
+	publicKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content))
+	if err != nil || len(publicKey) != 32 {
+		return recipient, errors.New("public key must be a base64 encoded 32 byte key")
+	}
+
+	copy(recipient[:], publicKey)
+
+	return recipient, nil
+}
+
+// EncodePublicKey returns the base64 encoded public key
+func EncodePublicKey(publicKey [32]byte) string {
+	return base64.StdEncoding.EncodeToString(publicKey[:])
+}
@@ -0,0 +1,74 @@
+package keyring
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestUnlockPassphrase(t *testing.T) {
+	k, dataKey, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = k.AddPassphrase(dataKey, "s3cr3t", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := k.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err = Parse(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlocked, err := k.Unlock("s3cr3t", nil)
+	if err != nil || !bytes.Equal(unlocked, dataKey) {
+		t.Errorf("expected the data key to unlock, got %v", err)
+	}
+
+	_, err = k.Unlock("wrong", nil)
+	if err == nil {
+		t.Error("expected a wrong passphrase to fail")
+	}
+}
+
+func TestUnlockRejectsTamperedKDF(t *testing.T) {
+	k, dataKey, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slot, err := k.AddPassphrase(dataKey, "s3cr3t", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := []KDF{
+		{N: 1 << 40, R: 8, P: 1},
+		{N: 3 << 10, R: 8, P: 1},
+		{N: 1 << 15, R: 1 << 20, P: 1},
+		{N: 1 << 15, R: 8, P: 1 << 20},
+		{N: 1 << 15, R: 0, P: 1},
+	}
+
+	for _, kdf := range tampered {
+		slot.KDF.N, slot.KDF.R, slot.KDF.P = kdf.N, kdf.R, kdf.P
+
+		started := time.Now()
+		_, err = k.Unlock("s3cr3t", nil)
+
+		if err == nil {
+			t.Errorf("n=%d, r=%d, p=%d: expected the slot to be rejected", kdf.N, kdf.R, kdf.P)
+		}
+
+		if elapsed := time.Since(started); elapsed > time.Second {
+			t.Errorf("n=%d, r=%d, p=%d: rejection took %s", kdf.N, kdf.R, kdf.P, elapsed)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -9,12 +10,15 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// output of the console writer, json logs are always written to stderr
+var output io.Writer = os.Stdout
+var logFormat string
+
 func SetupLogger(level string, format string) error {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	logFormat = format
 
-	if format != "json" {
-		log.Logger = zerolog.New(getOpinionatedConsoleWriter()).With().Timestamp().Logger()
-	}
+	setupOutput()
 
 	if level == "" {
 		return nil
@@ -31,8 +35,22 @@ func SetupLogger(level string, format string) error {
 	return nil
 }
 
+// UseStderr moves all logging to stderr, which is required whenever stdout carries data
+func UseStderr() {
+	output = os.Stderr
+	setupOutput()
+}
+
+func setupOutput() {
+	if logFormat != "json" {
+		log.Logger = zerolog.New(getOpinionatedConsoleWriter()).With().Timestamp().Logger()
+	} else {
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+	}
+}
+
 func getOpinionatedConsoleWriter() zerolog.ConsoleWriter {
-	output := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: "2006-01-02 15:04:05"}
+	output := zerolog.ConsoleWriter{Out: output, TimeFormat: "2006-01-02 15:04:05"}
 	output.NoColor = true
 	output.FormatLevel = func(i interface{}) string {
 		return strings.ToUpper(fmt.Sprintf("\t%-6s\t", i))
@@ -0,0 +1,201 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/scribblerockerz/parachute/pkg/config"
+	"github.com/scribblerockerz/parachute/pkg/s3"
+)
+
+// STATE_FILE is kept in the local directory and records the mirrored objects, so repeated runs only fetch new backups
+const STATE_FILE = ".parachute-mirror.json"
+
+// Entry records a remote object, which was mirrored into the local directory
+type Entry struct {
+	ETag     string    `json:"etag"`
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
+	Modified time.Time `json:"modified"`
+	Mirrored time.Time `json:"mirrored"`
+}
+
+// State maps the local names (relative to the directory, slash separated) to their mirrored objects
+type State map[string]*Entry
+
+func statePath(dir string) string {
+	return filepath.Join(dir, STATE_FILE)
+}
+
+// LoadState reads the mirror state of the local directory, a missing state is empty
+func LoadState(dir string) (State, error) {
+	state := State{}
+
+	content, err := os.ReadFile(statePath(dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirror state '%s': %s", statePath(dir), err)
+	}
+
+	return state, nil
+}
+
+// Save persists the mirror state into the local directory
+func (s State) Save(dir string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(statePath(dir)+".tmp", content, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(statePath(dir)+".tmp", statePath(dir))
+}
+
+// Current is true, when the object was mirrored before and the local copy is still present with the same size
+func (s State) Current(dir string, name string, object minio.ObjectInfo) bool {
+	entry, ok := s[name]
+	if !ok || entry.ETag != object.ETag || entry.Size != object.Size {
+		return false
+	}
+
+	stat, err := os.Stat(LocalPath(dir, name))
+
+	return err == nil && stat.Size() == entry.Size
+}
+
+// LocalPath is the location of the mirrored object in the local directory
+func LocalPath(dir string, name string) string {
+	return filepath.Join(dir, filepath.FromSlash(name))
+}
+
+// LocalName places the key relative to the remote prefix, a single object gets its base name.
+// Keys which would escape the local directory are rejected.
+func LocalName(key string, prefix string) (string, error) {
+	name := strings.TrimPrefix(key, prefix)
+	if key == prefix {
+		name = key[strings.LastIndex(key, "/")+1:]
+	}
+
+	cleaned := filepath.ToSlash(filepath.Clean(filepath.FromSlash(name)))
+	if name == "" || cleaned == ".." || strings.HasPrefix(cleaned, "../") || strings.HasPrefix(cleaned, "/") || cleaned == STATE_FILE {
+		return "", fmt.Errorf("object '%s' can not be mirrored into the local directory", key)
+	}
+
+	return cleaned, nil
+}
+
+// Fetch downloads the object next to its local path, compares it with the stored checksum and moves it into place
+func Fetch(ctx context.Context, client *s3.S3Client, bucket string, object minio.ObjectInfo, localPath string) (*Entry, error) {
+	info, err := client.StatObject(ctx, bucket, object.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(localPath), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	downloadPath := localPath + ".download"
+
+	downloadInfo, err := config.NewDownload(fmt.Sprintf("s3://%s/%s", bucket, object.Key), downloadPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.DownloadPayload(ctx, downloadInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums, err := archive.FileChecksums(downloadPath)
+	if err != nil {
+		os.Remove(downloadPath)
+		return nil, err
+	}
+
+	if stored := info.UserMetadata[s3.METADATA_SHA256]; stored != "" && stored != checksums.SHA256Hex() {
+		os.Remove(downloadPath)
+		return nil, fmt.Errorf("downloaded data of '%s' has sha256 %s, expected %s", object.Key, checksums.SHA256Hex(), stored)
+	}
+
+	if stat, err := os.Stat(downloadPath); err != nil || stat.Size() != info.Size {
+		os.Remove(downloadPath)
+		return nil, fmt.Errorf("downloaded data of '%s' does not match the remote size of %d bytes", object.Key, info.Size)
+	}
+
+	err = os.Rename(downloadPath, localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{
+		ETag:     info.ETag,
+		Size:     info.Size,
+		SHA256:   checksums.SHA256Hex(),
+		Modified: info.LastModified,
+		Mirrored: time.Now().UTC(),
+	}, nil
+}
+
+// Retain splits the remote objects and local entries into the newest `keep` names, which should be present locally,
+// and the local names exceeding the retention. A keep of 0 retains everything.
+func Retain(state State, objects map[string]minio.ObjectInfo, keep int) ([]string, []string) {
+	modified := map[string]time.Time{}
+
+	for name, entry := range state {
+		modified[name] = entry.Modified
+	}
+
+	for name, object := range objects {
+		if _, ok := modified[name]; !ok {
+			modified[name] = object.LastModified
+		}
+	}
+
+	names := make([]string, 0, len(modified))
+	for name := range modified {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, k int) bool {
+		if modified[names[i]].Equal(modified[names[k]]) {
+			return names[i] > names[k]
+		}
+
+		return modified[names[i]].After(modified[names[k]])
+	})
+
+	if keep <= 0 || len(names) <= keep {
+		return names, nil
+	}
+
+	var expired []string
+	for _, name := range names[keep:] {
+		if _, ok := state[name]; ok {
+			expired = append(expired, name)
+		}
+	}
+
+	return names[:keep], expired
+}
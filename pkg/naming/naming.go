@@ -0,0 +1,129 @@
+package naming
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DEFAULT_DATE_FORMAT = "2006-01-02"
+const DEFAULT_TIME_FORMAT = "150405"
+
+var placeholderPattern = regexp.MustCompile(`\{([a-z]+)(?::([^}]*))?\}`)
+
+// Vars are the values of a single run, all placeholders of the run resolve to the same time
+type Vars struct {
+	Job  string
+	Time time.Time
+}
+
+// HasPlaceholders is true, when the name contains at least one placeholder
+func HasPlaceholders(name string) bool {
+	return placeholderPattern.MatchString(name)
+}
+
+// StaticPrefix returns the directory in front of the first placeholder, which contains every expansion of the name
+func StaticPrefix(name string) string {
+	loc := placeholderPattern.FindStringIndex(name)
+	if loc == nil {
+		return name[:strings.LastIndex(name, "/")+1]
+	}
+
+	return name[:strings.LastIndex(name[:loc[0]], "/")+1]
+}
+
+// Pattern returns a regular expression matching every expansion of the name. A placeholder matches within a single
+// path segment, unless its layout contains "/".
+func Pattern(name string) string {
+	var pattern strings.Builder
+
+	last := 0
+	for _, loc := range placeholderPattern.FindAllStringSubmatchIndex(name, -1) {
+		pattern.WriteString(regexp.QuoteMeta(name[last:loc[0]]))
+
+		segments := 0
+		if loc[4] >= 0 {
+			segments = strings.Count(name[loc[4]:loc[5]], "/")
+		}
+		pattern.WriteString(strings.Repeat(`[^/]+/`, segments) + `[^/]+`)
+
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(name[last:]))
+
+	return pattern.String()
+}
+
+// ExpandStatic replaces the placeholders which resolve to the same value on every run ({hostname} and {job}),
+// the placeholders of the time and {uuid} remain
+func ExpandStatic(name string, vars Vars) (string, error) {
+	return expand(name, vars, true)
+}
+
+// Expand replaces the placeholders of remote and file names: {hostname}, {job}, {date}, {date:<go layout>},
+// {time}, {unix} and {uuid}
+func Expand(name string, vars Vars) (string, error) {
+	return expand(name, vars, false)
+}
+
+func expand(name string, vars Vars, static bool) (string, error) {
+	var expandErr error
+
+	expanded := placeholderPattern.ReplaceAllStringFunc(name, func(placeholder string) string {
+		match := placeholderPattern.FindStringSubmatch(placeholder)
+
+		if static && !isStatic(match[1]) {
+			return placeholder
+		}
+
+		value, err := resolve(match[1], match[2], vars)
+		if err != nil && expandErr == nil {
+			expandErr = fmt.Errorf("invalid placeholder %s in '%s': %s", placeholder, name, err)
+		}
+
+		return value
+	})
+
+	if expandErr != nil {
+		return "", expandErr
+	}
+
+	return expanded, nil
+}
+
+func isStatic(placeholder string) bool {
+	return placeholder == "hostname" || placeholder == "job"
+}
+
+func resolve(placeholder string, format string, vars Vars) (string, error) {
+	switch placeholder {
+	case "hostname":
+		return os.Hostname()
+	case "job":
+		if vars.Job == "" {
+			return "", fmt.Errorf("only available for jobs")
+		}
+		return vars.Job, nil
+	case "date":
+		if format == "" {
+			format = DEFAULT_DATE_FORMAT
+		}
+		return vars.Time.Format(format), nil
+	case "time":
+		if format == "" {
+			format = DEFAULT_TIME_FORMAT
+		}
+		return vars.Time.Format(format), nil
+	case "unix":
+		return strconv.FormatInt(vars.Time.Unix(), 10), nil
+	case "uuid":
+		return uuid.NewString(), nil
+	}
+
+	return "", fmt.Errorf("unknown placeholder")
+}
@@ -0,0 +1,71 @@
+package naming
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestStaticPrefix(t *testing.T) {
+	tests := map[string]string{
+		"backups/db.zip":                   "backups/",
+		"db.zip":                           "",
+		"backups/{date}/db.zip":            "backups/",
+		"backups/db-{date}/db.zip":         "backups/",
+		"backups/{hostname}/{date}/db.zip": "backups/",
+		"{job}/db.zip":                     "",
+		"backups/daily/db-{time}.zip":      "backups/daily/",
+	}
+
+	for name, expected := range tests {
+		if prefix := StaticPrefix(name); prefix != expected {
+			t.Errorf("%s: expected prefix '%s', got '%s'", name, expected, prefix)
+		}
+	}
+}
+
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		matches bool
+	}{
+		{"backups/{date}/db.zip", "backups/2026-10-19/db.zip", true},
+		{"backups/{date}/db.zip", "backups/2026-10-19/other/db.zip", false},
+		{"backups/{date}/db.zip", "backups//db.zip", false},
+		{"backups/{date:2006/01/02}/db.zip", "backups/2026/10/19/db.zip", true},
+		{"backups/{date:2006/01/02}/db.zip", "backups/2026/10/db.zip", false},
+		{"backups/db-{unix}.zip", "backups/db-1792368000.zip", true},
+		{"backups/db.zip", "backups/db.zip", true},
+		{"backups/db.zip", "backups/dbxzip", false},
+	}
+
+	for _, test := range tests {
+		matches := regexp.MustCompile("^" + Pattern(test.name) + "$").MatchString(test.value)
+		if matches != test.matches {
+			t.Errorf("%s: expected match %t for '%s'", test.name, test.matches, test.value)
+		}
+	}
+}
+
+func TestExpandStatic(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expanded, err := ExpandStatic("{hostname}/{job}/{date}/{uuid}-{time:1504}.zip", Vars{Job: "db", Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := hostname + "/db/{date}/{uuid}-{time:1504}.zip"; expanded != expected {
+		t.Errorf("expected '%s', got '%s'", expected, expanded)
+	}
+
+	_, err = ExpandStatic("{job}/{date}", Vars{})
+	if err == nil {
+		t.Error("expected {job} without a job to fail")
+	}
+}
@@ -0,0 +1,209 @@
+package rekey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+	"github.com/scribblerockerz/parachute/pkg/archive"
+	"github.com/scribblerockerz/parachute/pkg/s3"
+)
+
+// TEMP_SUFFIX marks the re-encrypted copy of an object, until it is verified and replaces the original
+const TEMP_SUFFIX = ".rekey"
+
+// ErrAlreadyRekeyed is returned for objects, which already open with the new passphrase (e.g. on a resumed run)
+var ErrAlreadyRekeyed = errors.New("already encrypted with the new passphrase")
+
+// ErrNotEncrypted is returned for objects, whose content is not encrypted
+var ErrNotEncrypted = errors.New("not encrypted")
+
+// Check returns the info of an object which needs to be re-encrypted, ErrAlreadyRekeyed or ErrNotEncrypted
+func Check(ctx context.Context, client *s3.S3Client, bucket string, key string, oldPassphrase string, newPassphrase string) (minio.ObjectInfo, error) {
+	info, err := client.StatObject(ctx, bucket, key)
+	if err != nil {
+		return info, err
+	}
+
+	opensOld, opensNew, err := probe(ctx, client, bucket, info, oldPassphrase, newPassphrase)
+	if err != nil {
+		return info, err
+	}
+
+	if opensNew && !opensOld {
+		return info, ErrAlreadyRekeyed
+	}
+
+	if !opensOld {
+		return info, errors.New("object does not open with the old passphrase")
+	}
+
+	return info, nil
+}
+
+// Rekey re-encrypts the object with the new passphrase. The plain data is only streamed, the re-encrypted copy is
+// uploaded next to the original, decrypted again and compared, before it replaces the original on the storage side.
+func Rekey(ctx context.Context, client *s3.S3Client, bucket string, key string, oldPassphrase string, newPassphrase string) (int64, error) {
+	tempKey := key + TEMP_SUFFIX
+
+	info, err := Check(ctx, client, bucket, key, oldPassphrase, newPassphrase)
+	if errors.Is(err, ErrAlreadyRekeyed) {
+		removeTemp(ctx, client, bucket, tempKey)
+		return info.Size, err
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	userMetadata := map[string]string{}
+	for k, v := range info.UserMetadata {
+		if k != s3.METADATA_SHA256 {
+			userMetadata[k] = v
+		}
+	}
+
+	var plainSHA256 string
+
+	written, err := client.RewriteObject(ctx, bucket, info, tempKey, userMetadata, func(r io.Reader, w io.Writer) error {
+		plain, err := archive.NewDecryptReader(r, oldPassphrase)
+		if err != nil {
+			return err
+		}
+
+		encrypted, err := archive.NewEncryptWriter(w, newPassphrase)
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+
+		_, err = io.Copy(encrypted, io.TeeReader(plain, hash))
+		if err != nil {
+			return err
+		}
+
+		plainSHA256 = hex.EncodeToString(hash.Sum(nil))
+
+		return encrypted.Close()
+	})
+	if err != nil {
+		removeTemp(ctx, client, bucket, tempKey)
+		return 0, err
+	}
+
+	err = verify(ctx, client, bucket, tempKey, newPassphrase, written, plainSHA256)
+	if err != nil {
+		removeTemp(ctx, client, bucket, tempKey)
+		return 0, err
+	}
+
+	// a backup uploaded in the meantime must not be replaced by the re-encrypted old one
+	current, err := client.StatObject(ctx, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if current.ETag != info.ETag {
+		removeTemp(ctx, client, bucket, tempKey)
+		return 0, errors.New("object changed while re-encrypting, run rekey again")
+	}
+
+	userMetadata[s3.METADATA_SHA256] = written
+
+	err = client.ReplaceObject(ctx, bucket, tempKey, key, userMetadata)
+	if err != nil {
+		return 0, err
+	}
+
+	replaced, err := client.StatObject(ctx, bucket, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if replaced.UserMetadata[s3.METADATA_SHA256] != written {
+		return 0, fmt.Errorf("replaced object does not carry the new checksum %s", written)
+	}
+
+	removeTemp(ctx, client, bucket, tempKey)
+
+	return replaced.Size, nil
+}
+
+func min(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// probe checks with the first and last bytes of the object, which of the passphrases opens it
+func probe(ctx context.Context, client *s3.S3Client, bucket string, info minio.ObjectInfo, oldPassphrase string, newPassphrase string) (bool, bool, error) {
+	if info.Size == 0 {
+		return false, false, ErrNotEncrypted
+	}
+
+	// the head covers a KDF header of the archive and the first encrypted block
+	head, err := client.ReadRange(ctx, bucket, info.Key, 0, min(info.Size, 1024))
+	if err != nil {
+		return false, false, err
+	}
+
+	if !archive.DetectFormat(head).IsEncrypted() {
+		return false, false, ErrNotEncrypted
+	}
+
+	if info.Size < 48 {
+		return false, false, fmt.Errorf("object is too small (%d bytes) for an encrypted archive", info.Size)
+	}
+
+	tail, err := client.ReadRange(ctx, bucket, info.Key, info.Size-32, 32)
+	if err != nil {
+		return false, false, err
+	}
+
+	return archive.OpensWith(head, tail, oldPassphrase), archive.OpensWith(head, tail, newPassphrase), nil
+}
+
+// verify decrypts the uploaded copy with the new passphrase and compares it with the data read from the original
+func verify(ctx context.Context, client *s3.S3Client, bucket string, key string, passphrase string, expectedSHA256 string, expectedPlainSHA256 string) error {
+	var encryptedHash, plainHash hash.Hash
+
+	err := client.ReadObject(ctx, bucket, key, func(r io.Reader) error {
+		encryptedHash, plainHash = sha256.New(), sha256.New()
+
+		plain, err := archive.NewDecryptReader(io.TeeReader(r, encryptedHash), passphrase)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(plainHash, plain)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("re-encrypted copy can not be decrypted: %s", err)
+	}
+
+	if hex.EncodeToString(encryptedHash.Sum(nil)) != expectedSHA256 {
+		return errors.New("re-encrypted copy differs from the uploaded data")
+	}
+
+	if hex.EncodeToString(plainHash.Sum(nil)) != expectedPlainSHA256 {
+		return errors.New("re-encrypted copy does not decrypt to the original data")
+	}
+
+	return nil
+}
+
+func removeTemp(ctx context.Context, client *s3.S3Client, bucket string, tempKey string) {
+	err := client.RemoveObject(ctx, bucket, tempKey)
+	if err != nil && minio.ToErrorResponse(err).StatusCode != 404 {
+		log.Warn().Err(err).Str("bucket", bucket).Str("object", tempKey).Msg("unable to remove temporary re-encrypted copy")
+	}
+}
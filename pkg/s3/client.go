@@ -3,47 +3,109 @@ package s3
 import (
 	"context"
 	"errors"
+	"os"
 	"strings"
 
 	minio "github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rs/zerolog/log"
 )
 
+// MAX_SINGLE_PUT_SIZE is the largest object S3 accepts within a single PUT request
+const MAX_SINGLE_PUT_SIZE = 5 * 1024 * 1024 * 1024
+
 type S3Client struct {
 	minioClient *minio.Client
+	retryPolicy RetryPolicy
 }
 
 func NewClient(endpoint string, accessKey string, secretKey string, useSSL bool) (*S3Client, error) {
-	minioClient, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: useSSL,
+	return NewClientWithOptions(ClientOptions{
+		Endpoint:  endpoint,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		UseSSL:    useSSL,
+	})
+}
+
+type ClientOptions struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	Region    string
+
+	// PathStyle forces path style requests ("endpoint/bucket/object"), as required by most MinIO setups
+	PathStyle bool
+}
+
+func NewClientWithOptions(options ClientOptions) (*S3Client, error) {
+	bucketLookup := minio.BucketLookupAuto
+	if options.PathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+
+	minioClient, err := minio.New(options.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(options.AccessKey, options.SecretKey, ""),
+		Secure:       options.UseSSL,
+		Region:       options.Region,
+		BucketLookup: bucketLookup,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &S3Client{minioClient}, nil
+	return &S3Client{minioClient, DefaultRetryPolicy()}, nil
 }
 
-type PayloadInfo struct {
-	Bucket      string
-	Object      string
-	FilePath    string
-	ContentType string
+// SetRetryPolicy replaces the policy which is applied to every storage operation of the client
+func (s3 *S3Client) SetRetryPolicy(policy RetryPolicy) {
+	s3.retryPolicy = policy
 }
 
-func NewPayload(remote string, filePath string) (*PayloadInfo, error) {
+// ParseRemote splits a remote in "s3://bucket/object" format into bucket and object (or prefix)
+func ParseRemote(remote string) (string, string, error) {
 	if !strings.HasPrefix(remote, "s3://") {
-		return nil, errors.New("invalid remote target provided. Expected 's3://bucket/object' format")
+		return "", "", errors.New("invalid remote target provided. Expected 's3://bucket/object' format")
 	}
 
 	remote, _ = strings.CutPrefix(remote, "s3://")
 	parts := strings.SplitAfterN(remote, "/", 2)
 
+	bucket := strings.Trim(parts[0], "/")
+	if bucket == "" {
+		return "", "", errors.New("invalid remote target provided. Bucket is missing")
+	}
+
+	if len(parts) == 1 {
+		return bucket, "", nil
+	}
+
+	return bucket, strings.TrimLeft(parts[1], "/"), nil
+}
+
+type PayloadInfo struct {
+	Bucket       string
+	Object       string
+	FilePath     string
+	ContentType  string
+	UserMetadata map[string]string
+
+	// Additional checksums (base64) which are validated by the storage while uploading
+	ChecksumSHA256 string
+	ChecksumCRC32C string
+}
+
+func NewPayload(remote string, filePath string) (*PayloadInfo, error) {
+	bucket, object, err := ParseRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+
 	return &PayloadInfo{
-		Bucket:      strings.Trim(parts[0], "/"),
-		Object:      strings.Trim(parts[1], "/"),
+		Bucket:      bucket,
+		Object:      strings.Trim(object, "/"),
 		FilePath:    filePath,
 		ContentType: "application/octet-stream",
 	}, nil
@@ -53,26 +115,42 @@ type DownloadInfo struct {
 	Bucket   string
 	Object   string
 	FilePath string
+
+	// VersionID downloads a specific version of the object, instead of the current one
+	VersionID string
+
+	// Concurrency is the amount of parallel ranged requests, PartSize the size of each range
+	Concurrency int
+	PartSize    int64
 }
 
 func NewDownload(remote string, filePath string) (*DownloadInfo, error) {
-	if !strings.HasPrefix(remote, "s3://") {
-		return nil, errors.New("invalid remote target provided. Expected 's3://bucket/object' format")
+	bucket, object, err := ParseRemote(remote)
+	if err != nil {
+		return nil, err
 	}
 
-	remote, _ = strings.CutPrefix(remote, "s3://")
-	parts := strings.SplitAfterN(remote, "/", 2)
-
 	return &DownloadInfo{
-		Bucket:   strings.Trim(parts[0], "/"),
-		Object:   strings.Trim(parts[1], "/"),
-		FilePath: filePath,
+		Bucket:      bucket,
+		Object:      strings.Trim(object, "/"),
+		FilePath:    filePath,
+		Concurrency: DEFAULT_DOWNLOAD_CONCURRENCY,
+		PartSize:    DEFAULT_DOWNLOAD_PART_SIZE,
 	}, nil
 }
 
 func (s3 *S3Client) UploadPayload(ctx context.Context, payload *PayloadInfo) (minio.UploadInfo, error) {
-	info, err := s3.minioClient.FPutObject(ctx, payload.Bucket, payload.Object, payload.FilePath, minio.PutObjectOptions{
-		ContentType: payload.ContentType,
+	opts, err := payload.putObjectOptions()
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+
+	var info minio.UploadInfo
+
+	err = s3.retryPolicy.withRetry(ctx, "upload", func(ctx context.Context) error {
+		var err error
+		info, err = s3.minioClient.FPutObject(ctx, payload.Bucket, payload.Object, payload.FilePath, opts)
+		return err
 	})
 	if err != nil {
 		return minio.UploadInfo{}, err
@@ -81,6 +159,42 @@ func (s3 *S3Client) UploadPayload(ctx context.Context, payload *PayloadInfo) (mi
 	return info, nil
 }
 
+func (payload *PayloadInfo) putObjectOptions() (minio.PutObjectOptions, error) {
+	opts := minio.PutObjectOptions{
+		ContentType:  payload.ContentType,
+		UserMetadata: map[string]string{},
+	}
+
+	for key, value := range payload.UserMetadata {
+		opts.UserMetadata[key] = value
+	}
+
+	if payload.ChecksumSHA256 == "" && payload.ChecksumCRC32C == "" {
+		return opts, nil
+	}
+
+	// Full object checksums are only supported by single part uploads
+	fileInfo, err := os.Stat(payload.FilePath)
+	if err != nil {
+		return opts, err
+	}
+
+	if fileInfo.Size() > MAX_SINGLE_PUT_SIZE {
+		log.Warn().Str("object", payload.Object).Msg("archive is too large for a single part upload, skipping additional upload checksum")
+		return opts, nil
+	}
+
+	opts.DisableMultipart = true
+
+	if payload.ChecksumCRC32C != "" {
+		opts.UserMetadata["X-Amz-Checksum-Crc32c"] = payload.ChecksumCRC32C
+	} else {
+		opts.UserMetadata["X-Amz-Checksum-Sha256"] = payload.ChecksumSHA256
+	}
+
+	return opts, nil
+}
+
 func (s3 *S3Client) DownloadPayload(ctx context.Context, info *DownloadInfo) error {
-	return s3.minioClient.FGetObject(ctx, info.Bucket, info.Object, info.FilePath, minio.GetObjectOptions{})
+	return s3.downloadRanged(ctx, info)
 }
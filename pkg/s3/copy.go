@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// SameContent reports whether both objects hold the same data, compared by the stored SHA-256 or,
+// without it, by size and a single part ETag
+func SameContent(a minio.ObjectInfo, b minio.ObjectInfo) bool {
+	shaA, shaB := a.UserMetadata[METADATA_SHA256], b.UserMetadata[METADATA_SHA256]
+	if shaA != "" && shaB != "" {
+		return shaA == shaB
+	}
+
+	return a.Size == b.Size && a.ETag == b.ETag && !strings.Contains(a.ETag, "-")
+}
+
+// COPY_SUFFIX is appended to the destination object while the copy is streamed and verified
+const COPY_SUFFIX = ".copy"
+
+// CopyObjectTo streams the object into the destination client, which may belong to another storage.
+// The user metadata is kept and the stored SHA-256 is checked while streaming. The data is written to a
+// temporary object first, an existing destination object is only replaced by a verified copy.
+func (s3 *S3Client) CopyObjectTo(ctx context.Context, dst *S3Client, source minio.ObjectInfo, srcBucket string, dstBucket string, dstObject string) error {
+	tempObject := dstObject + COPY_SUFFIX
+
+	err := s3.retryPolicy.withRetry(ctx, "copy", func(ctx context.Context) error {
+		object, err := s3.minioClient.GetObject(ctx, srcBucket, source.Key, minio.GetObjectOptions{VersionID: source.VersionID})
+		if err != nil {
+			return err
+		}
+		defer object.Close()
+
+		hash := sha256.New()
+
+		opts := minio.PutObjectOptions{
+			ContentType:  source.ContentType,
+			UserMetadata: source.UserMetadata,
+		}
+
+		_, err = dst.minioClient.PutObject(ctx, dstBucket, tempObject, io.TeeReader(object, hash), source.Size, opts)
+		if err != nil {
+			return err
+		}
+
+		stored := source.UserMetadata[METADATA_SHA256]
+		if stored != "" && stored != hex.EncodeToString(hash.Sum(nil)) {
+			return fmt.Errorf("copied data of '%s' does not match the stored checksum %s", source.Key, stored)
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		err = dst.ReplaceObject(ctx, dstBucket, tempObject, dstObject, source.UserMetadata)
+	}
+
+	removeErr := dst.RemoveObject(ctx, dstBucket, tempObject)
+	if err != nil {
+		return err
+	}
+
+	if removeErr != nil {
+		return fmt.Errorf("unable to remove the temporary copy '%s': %s", tempObject, removeErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,375 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+)
+
+const DEFAULT_DOWNLOAD_CONCURRENCY = 4
+const DEFAULT_DOWNLOAD_PART_SIZE = 16 * 1024 * 1024
+
+// downloadState is persisted next to a partial download, so an interrupted
+// restore can continue with the parts which are still missing
+type downloadState struct {
+	Bucket    string `json:"bucket"`
+	Object    string `json:"object"`
+	ETag      string `json:"etag"`
+	VersionID string `json:"versionId"`
+	Size      int64  `json:"size"`
+	PartSize  int64  `json:"partSize"`
+	Completed []bool `json:"completed"`
+}
+
+func (s *downloadState) matches(info minio.ObjectInfo, partSize int64) bool {
+	return s.ETag == info.ETag &&
+		s.VersionID == info.VersionID &&
+		s.Size == info.Size &&
+		s.PartSize == partSize &&
+		len(s.Completed) == partCount(info.Size, partSize)
+}
+
+func partCount(size int64, partSize int64) int {
+	if size == 0 {
+		return 0
+	}
+	return int((size + partSize - 1) / partSize)
+}
+
+// errLocked is returned by lockFile, when another process holds the lock
+var errLocked = errors.New("file is locked by another process")
+
+// partialLocation returns a stable location for the partial download of an object, independent of the temporary
+// directory of the current run. A destination keys a private location, which is used while another run holds the
+// shared one.
+func partialLocation(bucket string, object string, versionID string, destination string) (string, error) {
+	dir := filepath.Join(os.TempDir(), "parachute-partial")
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf("%s/%s?versionId=%s", bucket, object, versionID)
+	if destination != "" {
+		key += "\x00" + destination
+	}
+
+	sum := sha1.Sum([]byte(key))
+
+	return filepath.Join(dir, hex.EncodeToString(sum[:])), nil
+}
+
+// lockPartialLocation locks the partial download of the object, concurrent restores of the same object (like the
+// daemon and a manual run) fall back to a private location instead of writing into the same file
+func lockPartialLocation(info *DownloadInfo) (string, func(), error) {
+	partialPath, err := partialLocation(info.Bucket, info.Object, info.VersionID, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	unlock, err := lockFile(partialPath + ".lock")
+	if errors.Is(err, errLocked) {
+		log.Info().Str("bucket", info.Bucket).Str("object", info.Object).Msg("partial download is used by another run, downloading separately")
+
+		partialPath, err = partialLocation(info.Bucket, info.Object, info.VersionID, info.FilePath)
+		if err != nil {
+			return "", nil, err
+		}
+
+		unlock, err = lockFile(partialPath + ".lock")
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	return partialPath, unlock, nil
+}
+
+func loadDownloadState(statePath string) (*downloadState, error) {
+	content, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &downloadState{}
+	err = json.Unmarshal(content, state)
+	if err != nil {
+		log.Warn().Str("state", statePath).Err(err).Msg("ignoring unreadable download state")
+		return nil, nil
+	}
+
+	return state, nil
+}
+
+func (s *downloadState) save(statePath string) error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(statePath+".tmp", content, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(statePath+".tmp", statePath)
+}
+
+// downloadRanged fetches the object in concurrent byte ranges into a partial file, which
+// survives an interrupted run. All ranges are pinned to the ETag/version seen on start.
+func (s3 *S3Client) downloadRanged(ctx context.Context, info *DownloadInfo) error {
+	concurrency := info.Concurrency
+	if concurrency <= 0 {
+		concurrency = DEFAULT_DOWNLOAD_CONCURRENCY
+	}
+
+	partSize := info.PartSize
+	if partSize <= 0 {
+		partSize = DEFAULT_DOWNLOAD_PART_SIZE
+	}
+
+	var objectInfo minio.ObjectInfo
+
+	err := s3.retryPolicy.withRetry(ctx, "stat", func(ctx context.Context) error {
+		var err error
+		objectInfo, err = s3.minioClient.StatObject(ctx, info.Bucket, info.Object, minio.StatObjectOptions{VersionID: info.VersionID})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	partialPath, unlock, err := lockPartialLocation(info)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	statePath := partialPath + ".json"
+	partPath := partialPath + ".part"
+
+	state, err := loadDownloadState(statePath)
+	if err != nil {
+		return err
+	}
+
+	if state != nil && !state.matches(objectInfo, partSize) {
+		log.Info().Str("bucket", info.Bucket).Str("object", info.Object).Msg("remote object changed since last attempt, discarding partial download")
+		state = nil
+	}
+
+	if state == nil {
+		state = &downloadState{
+			Bucket:    info.Bucket,
+			Object:    info.Object,
+			ETag:      objectInfo.ETag,
+			VersionID: objectInfo.VersionID,
+			Size:      objectInfo.Size,
+			PartSize:  partSize,
+			Completed: make([]bool, partCount(objectInfo.Size, partSize)),
+		}
+
+		os.Remove(partPath)
+	} else {
+		log.Info().Str("bucket", info.Bucket).Str("object", info.Object).Msg("resuming partial download")
+	}
+
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = f.Truncate(objectInfo.Size)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = state.save(statePath)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = s3.downloadParts(ctx, f, state, statePath, concurrency)
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = moveFile(partPath, info.FilePath)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(statePath)
+}
+
+func (s3 *S3Client) downloadParts(ctx context.Context, f *os.File, state *downloadState, statePath string, concurrency int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parts := make(chan int)
+	errs := make(chan error, len(state.Completed))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for part := range parts {
+				err := s3.downloadPartWithRetry(ctx, f, state, part)
+				if err != nil {
+					errs <- err
+					cancel()
+					continue
+				}
+
+				mu.Lock()
+				state.Completed[part] = true
+				err = state.save(statePath)
+				mu.Unlock()
+
+				if err != nil {
+					errs <- err
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for part, completed := range state.Completed {
+		if completed {
+			continue
+		}
+
+		select {
+		case parts <- part:
+		case <-ctx.Done():
+		}
+	}
+	close(parts)
+
+	wg.Wait()
+	close(errs)
+
+	if err, ok := <-errs; ok {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+func (s3 *S3Client) downloadPartWithRetry(ctx context.Context, f *os.File, state *downloadState, part int) error {
+	err := s3.retryPolicy.withRetry(ctx, fmt.Sprintf("download part %d", part), func(ctx context.Context) error {
+		return s3.downloadPart(ctx, f, state, part)
+	})
+
+	if minio.ToErrorResponse(err).StatusCode == 412 {
+		return fmt.Errorf("remote object '%s' changed during download", state.Object)
+	}
+
+	return err
+}
+
+func (s3 *S3Client) downloadPart(ctx context.Context, f *os.File, state *downloadState, part int) error {
+	start := int64(part) * state.PartSize
+	end := start + state.PartSize - 1
+	if end >= state.Size {
+		end = state.Size - 1
+	}
+
+	opts := minio.GetObjectOptions{VersionID: state.VersionID}
+
+	err := opts.SetRange(start, end)
+	if err != nil {
+		return err
+	}
+
+	err = opts.SetMatchETag(state.ETag)
+	if err != nil {
+		return err
+	}
+
+	object, err := s3.minioClient.GetObject(ctx, state.Bucket, state.Object, opts)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	written, err := io.Copy(&offsetWriter{f, start}, object)
+	if err != nil {
+		return err
+	}
+
+	if written != end-start+1 {
+		return fmt.Errorf("received %d bytes for part %d, expected %d: %w", written, part, end-start+1, io.ErrUnexpectedEOF)
+	}
+
+	log.Debug().Str("object", state.Object).Int("part", part).Int64("start", start).Int64("end", end).Msg("downloaded part")
+
+	return nil
+}
+
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// moveFile renames the file and falls back to copying, when source and target are on different devices
+func moveFile(source string, target string) error {
+	err := os.Rename(source, target)
+	if err == nil {
+		return nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(source)
+}
@@ -0,0 +1,48 @@
+package s3
+
+import (
+	"context"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// ListObjects returns all objects below the prefix, directory markers are skipped
+func (s3 *S3Client) ListObjects(ctx context.Context, bucket string, prefix string) ([]minio.ObjectInfo, error) {
+	return s3.listObjects(ctx, bucket, prefix, false)
+}
+
+// ListObjectsWithMetadata includes the user metadata in the listing, where the storage supports it (MinIO).
+// Other storages ignore the request and return objects without user metadata.
+func (s3 *S3Client) ListObjectsWithMetadata(ctx context.Context, bucket string, prefix string) ([]minio.ObjectInfo, error) {
+	return s3.listObjects(ctx, bucket, prefix, true)
+}
+
+func (s3 *S3Client) listObjects(ctx context.Context, bucket string, prefix string, withMetadata bool) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+
+	err := s3.retryPolicy.withRetry(ctx, "list", func(ctx context.Context) error {
+		objects = nil
+
+		for object := range s3.minioClient.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, WithMetadata: withMetadata}) {
+			if object.Err != nil {
+				return object.Err
+			}
+
+			if object.Size == 0 && object.Key[len(object.Key)-1] == '/' {
+				continue
+			}
+
+			objects = append(objects, object)
+		}
+
+		return nil
+	})
+
+	return objects, err
+}
+
+func (s3 *S3Client) RemoveObject(ctx context.Context, bucket string, object string) error {
+	return s3.retryPolicy.withRetry(ctx, "remove", func(ctx context.Context) error {
+		return s3.minioClient.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{})
+	})
+}
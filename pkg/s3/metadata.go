@@ -0,0 +1,24 @@
+package s3
+
+import (
+	minio "github.com/minio/minio-go/v7"
+)
+
+// METADATA_SHA256 holds the hex encoded SHA-256 of the whole object, which parachute stores on upload
+const METADATA_SHA256 = "Parachute-Sha256"
+
+// METADATA_CREATED (RFC 3339), METADATA_JOB and METADATA_TAGS (comma separated) describe the backup
+// and are used to select it on restore
+const METADATA_CREATED = "Parachute-Created"
+const METADATA_JOB = "Parachute-Job"
+const METADATA_TAGS = "Parachute-Tags"
+
+// Metadata returns the user metadata value of the object. Listings with metadata keep the "X-Amz-Meta-" prefix of
+// the keys, object infos of StatObject do not.
+func Metadata(info minio.ObjectInfo, key string) string {
+	if value, ok := info.UserMetadata[key]; ok {
+		return value
+	}
+
+	return info.UserMetadata["X-Amz-Meta-"+key]
+}
@@ -0,0 +1,163 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+)
+
+const DEFAULT_RETRY_MAX_ATTEMPTS = 5
+const DEFAULT_RETRY_INITIAL_BACKOFF = time.Second
+const DEFAULT_RETRY_MAX_BACKOFF = 30 * time.Second
+
+// RetryPolicy describes how often and how patient a storage operation is repeated
+// on transient errors. A Timeout of zero disables the per-operation timeout.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    DEFAULT_RETRY_MAX_ATTEMPTS,
+		InitialBackoff: DEFAULT_RETRY_INITIAL_BACKOFF,
+		MaxBackoff:     DEFAULT_RETRY_MAX_BACKOFF,
+	}
+}
+
+// backoff returns an exponential delay for the given attempt with "equal jitter",
+// so the delay is always between the half and the full exponential value
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// withRetry runs the operation until it succeeds, fails with a fatal error or the policy is exhausted
+func (p RetryPolicy) withRetry(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	attempts := p.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var err error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = p.attempt(ctx, fn)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil || !IsRetryable(err) {
+			return err
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		delay := p.backoff(attempt)
+
+		log.Warn().Str("operation", operation).Int("attempt", attempt).Int("maxAttempts", attempts).Dur("delay", delay).Err(err).Msg("retrying failed storage operation")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+func (p RetryPolicy) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p.Timeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+// IsRetryable classifies an error of a storage operation as transient (retryable) or fatal
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	response := minio.ToErrorResponse(err)
+
+	switch response.Code {
+	case "SlowDown", "RequestTimeout", "RequestTimeTooSkewed", "InternalError", "ServiceUnavailable", "XMinioServerNotInitialized":
+		return true
+	}
+
+	switch response.StatusCode {
+	case 408, 429, 500, 502, 503, 504:
+		return true
+	}
+
+	return false
+}
+
+// IsUnavailable reports errors of a single storage, which another replica may not have: transient errors
+// which remained after all retries, denied access and missing buckets, objects or versions
+func IsUnavailable(err error) bool {
+	if IsRetryable(err) {
+		return true
+	}
+
+	response := minio.ToErrorResponse(err)
+
+	switch response.Code {
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "NoSuchBucket", "NoSuchKey", "NoSuchVersion":
+		return true
+	}
+
+	switch response.StatusCode {
+	case 401, 403, 404:
+		return true
+	}
+
+	return false
+}
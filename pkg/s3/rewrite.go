@@ -0,0 +1,218 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// RewriteObject streams the source object through rewrite into dstObject of the same bucket and returns the hex
+// encoded SHA-256 of the written data. Nothing is stored locally, a failed attempt is repeated from the start.
+func (s3 *S3Client) RewriteObject(ctx context.Context, bucket string, source minio.ObjectInfo, dstObject string, userMetadata map[string]string, rewrite func(r io.Reader, w io.Writer) error) (string, error) {
+	var written string
+
+	err := s3.retryPolicy.withRetry(ctx, "rewrite", func(ctx context.Context) error {
+		object, err := s3.minioClient.GetObject(ctx, bucket, source.Key, minio.GetObjectOptions{VersionID: source.VersionID})
+		if err != nil {
+			return err
+		}
+		defer object.Close()
+
+		hash := sha256.New()
+		pr, pw := io.Pipe()
+
+		go func() {
+			pw.CloseWithError(rewrite(object, io.MultiWriter(pw, hash)))
+		}()
+
+		// the size is unknown, without a part size minio buffers 5TiB/10000 bytes per part
+		_, err = s3.minioClient.PutObject(ctx, bucket, dstObject, pr, -1, minio.PutObjectOptions{
+			ContentType:  source.ContentType,
+			UserMetadata: userMetadata,
+			PartSize:     DEFAULT_DOWNLOAD_PART_SIZE,
+		})
+		pr.CloseWithError(err)
+		if err != nil {
+			return err
+		}
+
+		written = hex.EncodeToString(hash.Sum(nil))
+
+		return nil
+	})
+
+	return written, err
+}
+
+// ReadObjectContent reads the whole object and returns its content together with the ETag of the read data
+func (s3 *S3Client) ReadObjectContent(ctx context.Context, bucket string, object string) ([]byte, string, error) {
+	var content []byte
+	var etag string
+
+	err := s3.retryPolicy.withRetry(ctx, "read", func(ctx context.Context) error {
+		o, err := s3.minioClient.GetObject(ctx, bucket, object, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		defer o.Close()
+
+		info, err := o.Stat()
+		if err != nil {
+			return err
+		}
+
+		content, err = io.ReadAll(o)
+		etag = info.ETag
+
+		return err
+	})
+
+	return content, etag, err
+}
+
+// ReadObject streams the object into read
+func (s3 *S3Client) ReadObject(ctx context.Context, bucket string, object string, read func(r io.Reader) error) error {
+	return s3.retryPolicy.withRetry(ctx, "read", func(ctx context.Context) error {
+		o, err := s3.minioClient.GetObject(ctx, bucket, object, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		defer o.Close()
+
+		return read(o)
+	})
+}
+
+// ReplaceObject copies srcObject over object within the bucket on the storage side, replacing the user metadata
+func (s3 *S3Client) ReplaceObject(ctx context.Context, bucket string, srcObject string, object string, userMetadata map[string]string) error {
+	return s3.retryPolicy.withRetry(ctx, "replace", func(ctx context.Context) error {
+		_, err := s3.minioClient.ComposeObject(ctx,
+			minio.CopyDestOptions{Bucket: bucket, Object: object, UserMetadata: userMetadata, ReplaceMetadata: true},
+			minio.CopySrcOptions{Bucket: bucket, Object: srcObject},
+		)
+
+		return err
+	})
+}
+
+// ReadRange fetches length bytes of the object starting at offset
+func (s3 *S3Client) ReadRange(ctx context.Context, bucket string, object string, offset int64, length int64) ([]byte, error) {
+	var content []byte
+
+	err := s3.retryPolicy.withRetry(ctx, "read range", func(ctx context.Context) error {
+		opts := minio.GetObjectOptions{}
+		err := opts.SetRange(offset, offset+length-1)
+		if err != nil {
+			return err
+		}
+
+		o, err := s3.minioClient.GetObject(ctx, bucket, object, opts)
+		if err != nil {
+			return err
+		}
+		defer o.Close()
+
+		content, err = io.ReadAll(o)
+
+		return err
+	})
+
+	return content, err
+}
+
+// ErrPreconditionFailed is returned by WriteObject, when the object no longer has the expected ETag
+var ErrPreconditionFailed = errors.New("object was changed concurrently")
+
+// WriteObject stores the content as object and returns its ETag. A matchETag only replaces the object, while it
+// still has this ETag (conditional write), an empty matchETag writes unconditionally.
+func (s3 *S3Client) WriteObject(ctx context.Context, bucket string, object string, content []byte, contentType string, matchETag string) (string, error) {
+	var etag string
+
+	err := s3.retryPolicy.withRetry(ctx, "write", func(ctx context.Context) error {
+		opts := minio.PutObjectOptions{ContentType: contentType}
+		if matchETag != "" {
+			opts.SetMatchETag(matchETag)
+		}
+
+		info, err := s3.minioClient.PutObject(ctx, bucket, object, bytes.NewReader(content), int64(len(content)), opts)
+		if minio.ToErrorResponse(err).StatusCode == http.StatusPreconditionFailed {
+			return ErrPreconditionFailed
+		}
+		if err != nil {
+			return err
+		}
+
+		etag = info.ETag
+
+		return nil
+	})
+
+	return etag, err
+}
+
+// CreateObject stores the content as a new object and returns its ETag, an existing object is never replaced
+// (If-None-Match: *) and fails with ErrPreconditionFailed. The condition is sent with a presigned request, as
+// PutObjectOptions only sends quoted ETags.
+func (s3 *S3Client) CreateObject(ctx context.Context, bucket string, object string, content []byte, contentType string) (string, error) {
+	var etag string
+
+	err := s3.retryPolicy.withRetry(ctx, "create", func(ctx context.Context) error {
+		headers := http.Header{}
+		headers.Set("If-None-Match", "*")
+		headers.Set("Content-Type", contentType)
+
+		u, err := s3.minioClient.PresignHeader(ctx, http.MethodPut, bucket, object, 15*time.Minute, nil, headers)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		req.Header = headers
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		// 409 is returned for a concurrent conditional write of the same key
+		if res.StatusCode == http.StatusPreconditionFailed || res.StatusCode == http.StatusConflict {
+			return ErrPreconditionFailed
+		}
+
+		if res.StatusCode != http.StatusOK {
+			return readErrorResponse(res)
+		}
+
+		etag = strings.Trim(res.Header.Get("ETag"), "\"")
+
+		return nil
+	})
+
+	return etag, err
+}
+
+// readErrorResponse parses the S3 XML error of a failed request
+func readErrorResponse(res *http.Response) error {
+	errorResponse := minio.ErrorResponse{StatusCode: res.StatusCode}
+
+	content, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if xml.Unmarshal(content, &errorResponse) != nil || errorResponse.Code == "" {
+		errorResponse.Code = res.Status
+		errorResponse.Message = strings.TrimSpace(string(content))
+	}
+
+	return errorResponse
+}
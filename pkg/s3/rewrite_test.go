@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCreateObject(t *testing.T) {
+	var mutex sync.Mutex
+	objects := map[string]string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if r.Method != http.MethodPut || r.Header.Get("If-None-Match") != "*" || !strings.Contains(r.URL.RawQuery, "if-none-match") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := objects[r.URL.Path]; ok {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		content, _ := io.ReadAll(r.Body)
+		objects[r.URL.Path] = string(content)
+
+		w.Header().Set("ETag", `"etag-1"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithOptions(ClientOptions{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		AccessKey: "access",
+		SecretKey: "secret",
+		Region:    "us-east-1",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	etag, err := client.CreateObject(context.Background(), "bucket", "keys.json", []byte("{}"), "application/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if etag != "etag-1" || objects["/bucket/keys.json"] != "{}" {
+		t.Errorf("unexpected etag '%s' or objects %v", etag, objects)
+	}
+
+	_, err = client.CreateObject(context.Background(), "bucket", "keys.json", []byte("{}"), "application/json")
+	if !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("expected an existing object to fail, got %v", err)
+	}
+}
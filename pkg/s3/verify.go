@@ -0,0 +1,108 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+)
+
+// Verification describes the expected state of a remote object
+type Verification struct {
+	Size   int64
+	SHA256 []byte
+	CRC32C string
+
+	// Download the whole object and compare its SHA-256
+	Download bool
+}
+
+// StatObject fetches the object info including any additional checksums stored with the object
+func (s3 *S3Client) StatObject(ctx context.Context, bucket string, object string) (minio.ObjectInfo, error) {
+	return s3.StatObjectVersion(ctx, bucket, object, "")
+}
+
+// StatObjectVersion fetches the object info of a specific version, an empty version is the current one
+func (s3 *S3Client) StatObjectVersion(ctx context.Context, bucket string, object string, versionID string) (minio.ObjectInfo, error) {
+	var info minio.ObjectInfo
+
+	err := s3.retryPolicy.withRetry(ctx, "stat", func(ctx context.Context) error {
+		var err error
+		info, err = s3.minioClient.StatObject(ctx, bucket, object, minio.StatObjectOptions{Checksum: true, VersionID: versionID})
+		return err
+	})
+
+	return info, err
+}
+
+// VerifyObject compares size and checksums of the remote object with the expected values
+func (s3 *S3Client) VerifyObject(ctx context.Context, bucket string, object string, expected Verification) error {
+	info, err := s3.StatObject(ctx, bucket, object)
+	if err != nil {
+		return err
+	}
+
+	if info.Size != expected.Size {
+		return fmt.Errorf("remote object '%s' has size %d, expected %d", object, info.Size, expected.Size)
+	}
+
+	if stored := info.UserMetadata[METADATA_SHA256]; stored != "" && stored != hex.EncodeToString(expected.SHA256) {
+		return fmt.Errorf("remote object '%s' has SHA-256 %s, expected %s", object, stored, hex.EncodeToString(expected.SHA256))
+	}
+
+	// Checksums of multipart uploads are checksums of the part checksums ("<checksum>-<parts>")
+	if info.ChecksumSHA256 != "" && !strings.Contains(info.ChecksumSHA256, "-") {
+		if info.ChecksumSHA256 != base64.StdEncoding.EncodeToString(expected.SHA256) {
+			return fmt.Errorf("remote object '%s' has S3 SHA-256 checksum %s, expected %s", object, info.ChecksumSHA256, base64.StdEncoding.EncodeToString(expected.SHA256))
+		}
+	}
+
+	if expected.CRC32C != "" && info.ChecksumCRC32C != "" && !strings.Contains(info.ChecksumCRC32C, "-") {
+		if info.ChecksumCRC32C != expected.CRC32C {
+			return fmt.Errorf("remote object '%s' has S3 CRC32C checksum %s, expected %s", object, info.ChecksumCRC32C, expected.CRC32C)
+		}
+	}
+
+	log.Debug().Str("bucket", bucket).Str("object", object).Int64("size", info.Size).Msg("verified remote object metadata")
+
+	if !expected.Download {
+		return nil
+	}
+
+	var downloaded []byte
+
+	err = s3.retryPolicy.withRetry(ctx, "verify download", func(ctx context.Context) error {
+		reader, err := s3.minioClient.GetObject(ctx, bucket, object, minio.GetObjectOptions{VersionID: info.VersionID})
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		hash := sha256.New()
+		_, err = io.Copy(hash, reader)
+		if err != nil {
+			return err
+		}
+
+		downloaded = hash.Sum(nil)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(downloaded, expected.SHA256) {
+		return fmt.Errorf("downloaded object '%s' has SHA-256 %s, expected %s", object, hex.EncodeToString(downloaded), hex.EncodeToString(expected.SHA256))
+	}
+
+	log.Debug().Str("bucket", bucket).Str("object", object).Msg("verified downloaded remote object")
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package s3
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// ObjectVersion is a single version of an object in a versioned bucket
+type ObjectVersion struct {
+	VersionID      string
+	LastModified   time.Time
+	Size           int64
+	IsLatest       bool
+	IsDeleteMarker bool
+}
+
+// ListVersions returns all versions of the object from newest to oldest, including delete markers
+func (s3 *S3Client) ListVersions(ctx context.Context, bucket string, object string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+
+	err := s3.retryPolicy.withRetry(ctx, "list versions", func(ctx context.Context) error {
+		versions = nil
+
+		for o := range s3.minioClient.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: object, WithVersions: true}) {
+			if o.Err != nil {
+				return o.Err
+			}
+
+			if o.Key != object {
+				continue
+			}
+
+			versions = append(versions, ObjectVersion{
+				VersionID:      o.VersionID,
+				LastModified:   o.LastModified,
+				Size:           o.Size,
+				IsLatest:       o.IsLatest,
+				IsDeleteMarker: o.IsDeleteMarker,
+			})
+		}
+
+		return nil
+	})
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+
+	return versions, err
+}
+
+func (s3 *S3Client) RemoveObjectVersion(ctx context.Context, bucket string, object string, versionID string) error {
+	return s3.retryPolicy.withRetry(ctx, "remove", func(ctx context.Context) error {
+		return s3.minioClient.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{VersionID: versionID})
+	})
+}
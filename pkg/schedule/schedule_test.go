@@ -0,0 +1,102 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRejectsInvalidSchedules(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"@every 30s",
+		"@every soon",
+		"@sometimes",
+	} {
+		_, err := Parse(spec)
+		if err == nil {
+			t.Errorf("expected schedule '%s' to be rejected", spec)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	tests := []struct {
+		spec  string
+		after string
+		next  string
+	}{
+		{"* * * * *", "2026-10-19 10:15:30", "2026-10-19 10:16:00"},
+		{"0 2 * * *", "2026-10-19 10:15:00", "2026-10-20 02:00:00"},
+		{"0 2 * * *", "2026-10-19 01:59:00", "2026-10-19 02:00:00"},
+		{"*/15 * * * *", "2026-10-19 10:15:00", "2026-10-19 10:30:00"},
+		{"10-40/10 * * * *", "2026-10-19 10:41:00", "2026-10-19 11:10:00"},
+		{"0 0 1,15 * *", "2026-10-02 00:00:00", "2026-10-15 00:00:00"},
+		{"0 0 1 1 *", "2026-10-19 00:00:00", "2027-01-01 00:00:00"},
+		{"0 0 29 2 *", "2026-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"@daily", "2026-10-19 10:00:00", "2026-10-20 00:00:00"},
+		{"@hourly", "2026-10-19 10:00:00", "2026-10-19 11:00:00"},
+
+		// 2026-10-19 is a Monday, Sunday is 0 and 7
+		{"0 0 * * 0", "2026-10-19 00:00:00", "2026-10-25 00:00:00"},
+		{"0 0 * * 7", "2026-10-19 00:00:00", "2026-10-25 00:00:00"},
+		{"0 0 * * 1-5", "2026-10-23 12:00:00", "2026-10-26 00:00:00"},
+
+		// both days restricted combine with OR, the 1st of the month or any Monday
+		{"0 0 1 * 1", "2026-10-19 12:00:00", "2026-10-26 00:00:00"},
+		{"0 0 1 * 1", "2026-10-26 12:00:00", "2026-11-01 00:00:00"},
+
+		// a field starting with "*" is unrestricted, every odd day which is a Monday
+		{"0 0 */2 * 1", "2026-10-19 12:00:00", "2026-11-09 00:00:00"},
+		{"0 0 1 * */2", "2026-10-19 12:00:00", "2026-11-01 00:00:00"},
+	}
+
+	for _, test := range tests {
+		s, err := Parse(test.spec)
+		if err != nil {
+			t.Fatalf("%s: %s", test.spec, err)
+		}
+
+		after, _ := time.ParseInLocation("2006-01-02 15:04:05", test.after, time.UTC)
+		expected, _ := time.ParseInLocation("2006-01-02 15:04:05", test.next, time.UTC)
+
+		if next := s.Next(after); !next.Equal(expected) {
+			t.Errorf("%s after %s: expected %s, got %s", test.spec, test.after, test.next, next.Format("2006-01-02 15:04:05"))
+		}
+	}
+}
+
+func TestCronScheduleImpossibleDate(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next := s.Next(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)); !next.IsZero() {
+		t.Errorf("expected no activation, got %s", next)
+	}
+}
+
+func TestIntervalScheduleNext(t *testing.T) {
+	s, err := Parse("@every 6h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := time.Date(2026, 10, 19, 10, 15, 30, 0, time.UTC)
+
+	if next := s.Next(after); !next.Equal(after.Add(6 * time.Hour)) {
+		t.Errorf("expected %s, got %s", after.Add(6*time.Hour), next)
+	}
+}